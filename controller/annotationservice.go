@@ -0,0 +1,96 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"fmt"
+	"time"
+	"github.com/sfloresk/tviewer/model"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Longest annotation accepted, so notes stay readable on the topology
+const maxAnnotationLength = 1024
+
+func listAnnotations() ([]model.Annotation, error) {
+	session, dbCollection, err := openCollection("Annotations")
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	annotations := make([]model.Annotation, 0)
+	if err = dbCollection.Find(nil).All(&annotations); err != nil {
+		return nil, fmt.Errorf("cannot read annotations table: %v", err)
+	}
+	return annotations, nil
+}
+
+// setAnnotation stores the note of the user on the node and sends the
+// topology again with it
+func setAnnotation(node string, text string, user string, telemetryChannel chan model.TelemetryWrapper) (annotation model.Annotation, err error) {
+	defer func() {
+		recordAudit(user, auditAnnotationSet, node, "", err)
+	}()
+
+	annotation = model.Annotation{Node: node, Text: text, User: user, Updated: time.Now()}
+	if node == "" {
+		return annotation, newServiceError(errorInvalid, "Node is required")
+	}
+	if text == "" {
+		return annotation, newServiceError(errorInvalid, "Text is required, delete the annotation to remove it")
+	}
+	if len(text) > maxAnnotationLength {
+		return annotation, newServiceError(errorInvalid, "Text cannot be longer than %v characters", maxAnnotationLength)
+	}
+
+	session, dbCollection, err := openCollection("Annotations")
+	if err != nil {
+		return annotation, err
+	}
+	defer session.Close()
+
+	if _, err = dbCollection.Upsert(bson.M{"node": node}, &annotation); err != nil {
+		return annotation, fmt.Errorf("cannot update annotations table: %v", err)
+	}
+	telemetryChannel <- model.TelemetryWrapper{}
+	return annotation, nil
+}
+
+func deleteAnnotation(node string, telemetryChannel chan model.TelemetryWrapper, actor string) (err error) {
+	defer func() {
+		recordAudit(actor, auditAnnotationDelete, node, "", err)
+	}()
+
+	session, dbCollection, err := openCollection("Annotations")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	err = dbCollection.Remove(bson.M{"node": node})
+	if err == mgo.ErrNotFound {
+		return newServiceError(errorNotFound, "Node %v has no annotation", node)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot delete data in annotations table: %v", err)
+	}
+	telemetryChannel <- model.TelemetryWrapper{}
+	return nil
+}
@@ -0,0 +1,100 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"encoding/json"
+	"io/fs"
+	"log"
+	"net/http"
+)
+
+// Error codes returned in API error bodies, see api/openapi.json
+const (
+	codeInvalidRequest   = "invalid_request"
+	codeNotFound         = "not_found"
+	codeConflict         = "conflict"
+	codeMethodNotAllowed = "method_not_allowed"
+	codePartialFailure   = "partial_failure"
+	codeInternal         = "internal_error"
+)
+
+type apiError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+type apiErrorBody struct {
+	Error apiError `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, apiErrorBody{Error: apiError{Code: code, Message: message}})
+}
+
+// writeServiceError reports err with the status that matches its kind
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch kindOf(err) {
+	case errorInvalid:
+		writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+	case errorNotFound:
+		writeAPIError(w, http.StatusNotFound, codeNotFound, err.Error())
+	case errorConflict:
+		writeAPIError(w, http.StatusConflict, codeConflict, err.Error())
+	case errorPartial:
+		log.Print(err)
+		writeJSON(w, http.StatusInternalServerError, apiErrorBody{Error: apiError{
+			Code:    codePartialFailure,
+			Message: err.Error(),
+			Details: err.(*serviceError).details,
+		}})
+	default:
+		log.Print(err)
+		writeAPIError(w, http.StatusInternalServerError, codeInternal, err.Error())
+	}
+}
+
+// decodeJSONBody decodes the request body into v, writing a 400 on failure
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, "Invalid JSON body: " + err.Error())
+		return false
+	}
+	return true
+}
+
+func handleMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method " + r.Method + " not allowed on " + r.URL.Path)
+}
+
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	raw, err := fs.ReadFile(assets, "api/openapi.json")
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(raw)
+}
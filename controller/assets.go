@@ -0,0 +1,124 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"html/template"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Page templates, static files, telemetry templates and the OpenAPI
+// description. Reads go to the assets last given to SetAssets, so they can be
+// replaced on reload.
+var assets fs.FS = liveAssets{}
+
+var loadedAssets fs.FS
+var assetsMutex sync.RWMutex
+
+type liveAssets struct {
+}
+
+func (liveAssets) Open(name string) (fs.File, error) {
+	assetsMutex.RLock()
+	defer assetsMutex.RUnlock()
+	return loadedAssets.Open(name)
+}
+
+func (liveAssets) ReadDir(name string) ([]fs.DirEntry, error) {
+	assetsMutex.RLock()
+	defer assetsMutex.RUnlock()
+	return fs.ReadDir(loadedAssets, name)
+}
+
+// overlayFS serves the files of dir, and the embedded ones that dir does
+// not have
+type overlayFS struct {
+	dir      fs.FS
+	embedded fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.dir.Open(name)
+	if err == nil {
+		return f, nil
+	}
+	return o.embedded.Open(name)
+}
+
+// ReadDir lists the files of both, so new templates can be added in dir
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	embedded, err := fs.ReadDir(o.embedded, name)
+	overrides, overrideErr := fs.ReadDir(o.dir, name)
+	if (err != nil && overrideErr != nil) {
+		return nil, err
+	}
+	entries := make(map[string]fs.DirEntry)
+	for _, entry := range embedded {
+		entries[entry.Name()] = entry
+	}
+	for _, entry := range overrides {
+		entries[entry.Name()] = entry
+	}
+	result := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+	return result, nil
+}
+
+// OverlayAssets returns the embedded assets, overlaid with the files in
+// assetsDir when it is set
+func OverlayAssets(embedded fs.FS) fs.FS {
+	dir := currentConfig().AssetsDir
+	if dir == "" {
+		return embedded
+	}
+	log.Println("Serving assets from " + dir + " before the embedded ones")
+	return overlayFS{dir: os.DirFS(dir), embedded: embedded}
+}
+
+// SetAssets replaces the assets of the package. It must be called before
+// Startup.
+func SetAssets(a fs.FS) {
+	assetsMutex.Lock()
+	loadedAssets = a
+	assetsMutex.Unlock()
+}
+
+// Page templates by file name, see SetTemplates
+var pages map[string]*template.Template
+var pagesMutex sync.RWMutex
+
+// SetTemplates replaces the page templates. Startup sets the first ones.
+func SetTemplates(templates map[string]*template.Template) {
+	pagesMutex.Lock()
+	pages = templates
+	pagesMutex.Unlock()
+}
+
+// page returns the template of the page file
+func page(name string) *template.Template {
+	pagesMutex.RLock()
+	defer pagesMutex.RUnlock()
+	return pages[name]
+}
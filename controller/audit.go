@@ -0,0 +1,244 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"github.com/gorilla/mux"
+	"github.com/sfloresk/tviewer/model"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Audited actions
+const (
+	auditDeviceCreate      = "device.create"
+	auditDeviceUpdate      = "device.update"
+	auditDeviceCredentials = "device.credentials"
+	auditDeviceDelete      = "device.delete"
+	auditDeviceRestart     = "device.restart"
+	auditConfigMerge       = "config.merge"
+	auditConfigDelete      = "config.delete"
+	auditProfileCreate     = "profile.create"
+	auditProfileUpdate     = "profile.update"
+	auditProfileDelete     = "profile.delete"
+	auditUserCreate        = "user.create"
+	auditUserDelete        = "user.delete"
+	auditUserRole          = "user.role"
+	auditUserPassword      = "user.password"
+	auditTokenCreate       = "token.create"
+	auditTokenDelete       = "token.delete"
+	auditAnnotationSet     = "annotation.set"
+	auditAnnotationDelete  = "annotation.delete"
+)
+
+// Actors of actions that no user started
+const (
+	actorSystem     = "system"
+	actorNetboxSync = "netbox-sync"
+)
+
+const (
+	auditResultSuccess = "success"
+	auditResultFailure = "failure"
+)
+
+// Entries returned by /api/audit when no limit is given, and the most it returns
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+)
+
+// configHash identifies the rendered configs pushed to a router
+func configHash(configs ...string) string {
+	h := sha256.New()
+	for _, config := range configs {
+		h.Write([]byte(config))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordAudit appends an entry for the action. Failing to record it is
+// logged but does not fail the action, which already happened.
+func recordAudit(actor string, action string, target string, hash string, err error) {
+	entry := model.AuditEntry{
+		Time:       time.Now(),
+		User:       actor,
+		Action:     action,
+		Target:     target,
+		Result:     auditResultSuccess,
+		ConfigHash: hash,
+	}
+	if err != nil {
+		entry.Result = auditResultFailure
+		entry.Error = err.Error()
+	}
+
+	session, dbCollection, err := openCollection("Audit")
+	if err != nil {
+		log.Printf("Cannot record audit entry %+v: %v", entry, err)
+		return
+	}
+	defer session.Close()
+
+	if err = dbCollection.Insert(&entry); err != nil {
+		log.Printf("Cannot record audit entry %+v: %v", entry, err)
+	}
+}
+
+// auditQuery selects audit entries, empty fields match everything
+type auditQuery struct {
+	User   string
+	Action string
+	Target string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+func (q auditQuery) filter() bson.M {
+	filter := bson.M{}
+	if q.User != "" {
+		filter["user"] = q.User
+	}
+	if q.Action != "" {
+		filter["action"] = q.Action
+	}
+	if q.Target != "" {
+		filter["target"] = q.Target
+	}
+	if !q.Since.IsZero() || !q.Until.IsZero() {
+		period := bson.M{}
+		if !q.Since.IsZero() {
+			period["$gte"] = q.Since
+		}
+		if !q.Until.IsZero() {
+			period["$lt"] = q.Until
+		}
+		filter["time"] = period
+	}
+	return filter
+}
+
+// parseAuditQuery reads the user, action, target, since, until (RFC 3339)
+// and limit query parameters
+func parseAuditQuery(r *http.Request) (auditQuery, error) {
+	values := r.URL.Query()
+	q := auditQuery{
+		User:   values.Get("user"),
+		Action: values.Get("action"),
+		Target: values.Get("target"),
+		Limit:  auditDefaultLimit,
+	}
+	var err error
+	if since := values.Get("since"); since != "" {
+		if q.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return q, newServiceError(errorInvalid, "Invalid since %v, expected RFC 3339", since)
+		}
+	}
+	if until := values.Get("until"); until != "" {
+		if q.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return q, newServiceError(errorInvalid, "Invalid until %v, expected RFC 3339", until)
+		}
+	}
+	if limit := values.Get("limit"); limit != "" {
+		q.Limit, err = strconv.Atoi(limit)
+		if err != nil || q.Limit < 1 || q.Limit > auditMaxLimit {
+			return q, newServiceError(errorInvalid, "Limit must be between 1 and %v", auditMaxLimit)
+		}
+	}
+	return q, nil
+}
+
+// listAudit returns the newest entries that match the query
+func listAudit(q auditQuery) ([]model.AuditEntry, error) {
+	session, dbCollection, err := openCollection("Audit")
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	entries := make([]model.AuditEntry, 0)
+	err = dbCollection.Find(q.filter()).Sort("-time").Limit(q.Limit).All(&entries)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read audit table: %v", err)
+	}
+	return entries, nil
+}
+
+// auditLog serves the audit entries to admins
+type auditLog struct {
+}
+
+func (a auditLog) registerRoutes(r *mux.Router) {
+	r.HandleFunc("/api/audit", requireRole(roleAdmin, a.handleListAudit)).Methods("GET")
+	r.HandleFunc("/api/audit", handleMethodNotAllowed)
+	r.HandleFunc("/api/audit/export", requireRole(roleAdmin, a.handleExportAudit)).Methods("GET")
+	r.HandleFunc("/api/audit/export", handleMethodNotAllowed)
+}
+
+func (a auditLog) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAuditQuery(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	entries, err := listAudit(q)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// handleExportAudit streams every matching entry as NDJSON, oldest first.
+// The limit parameter is ignored.
+func (a auditLog) handleExportAudit(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAuditQuery(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	session, dbCollection, err := openCollection("Audit")
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	defer session.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"tviewer-audit.ndjson\"")
+	encoder := json.NewEncoder(w)
+	iter := dbCollection.Find(q.filter()).Sort("time").Iter()
+	var entry model.AuditEntry
+	for iter.Next(&entry) {
+		if err = encoder.Encode(entry); err != nil {
+			break
+		}
+	}
+	if err = iter.Close(); err != nil {
+		// Too late to change the status, the export ends early
+		log.Printf("Cannot export audit entries: %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"github.com/gorilla/mux"
+	"github.com/sfloresk/tviewer/model"
+)
+
+// Cookie that holds the session of the web UI
+const sessionCookie = "tviewer_session"
+
+// Sessions expire after being idle for this long
+const sessionIdleTimeout = 12 * time.Hour
+
+// Time between sweeps of the expired sessions
+const sessionSweepInterval = 10 * time.Minute
+
+const codeUnauthorized = "unauthorized"
+
+type userSession struct {
+	user    string
+	expires time.Time
+}
+
+// sessionStore keeps the sessions of the web UI in memory, so users log in
+// again after a restart
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*userSession
+}
+
+var sessions = sessionStore{sessions: make(map[string]*userSession)}
+
+func (s *sessionStore) create(user string) string {
+	id := randomHex(32)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[id] = &userSession{user: user, expires: time.Now().Add(sessionIdleTimeout)}
+	return id
+}
+
+// get returns the user of the session, extending it
+func (s *sessionStore) get(id string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(session.expires) {
+		delete(s.sessions, id)
+		return "", false
+	}
+	session.expires = time.Now().Add(sessionIdleTimeout)
+	return session.user, true
+}
+
+func (s *sessionStore) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+// sweep forgets the expired sessions. get only removes those that are used
+// again, the others would stay in memory for good.
+func (s *sessionStore) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, session := range s.sessions {
+		if now.After(session.expires) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// sweepSessions sweeps the sessions every sessionSweepInterval until tviewer
+// shuts down
+func sweepSessions() {
+	ticker := time.NewTicker(sessionSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			sessions.sweep()
+		case <-shuttingDown:
+			return
+		}
+	}
+}
+
+// revokeUser ends all the sessions of the user, e.g. when its password changes
+func (s *sessionStore) revokeUser(user string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, session := range s.sessions {
+		if session.user == user {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+type contextKey int
+
+const userContextKey contextKey = iota
+
+// requestUser returns the user authenticated for the request
+func requestUser(r *http.Request) model.User {
+	user, _ := r.Context().Value(userContextKey).(model.User)
+	return user
+}
+
+// authenticate returns the user of the session cookie or of the API token in
+// the Authorization header
+func authenticate(r *http.Request) (model.User, bool) {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return userForToken(strings.TrimPrefix(header, "Bearer "))
+	}
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return model.User{}, false
+	}
+	name, ok := sessions.get(cookie.Value)
+	if !ok {
+		return model.User{}, false
+	}
+	user, err := getUser(name)
+	return user, err == nil
+}
+
+// requiresAuth tells whether the path is only available to logged in users.
+// The login page and the static assets are public.
+func requiresAuth(path string) bool {
+	for _, prefix := range []string{"/api/", "/ng/", "/ws/", "/sse/", "/web/"} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// authMiddleware rejects unauthenticated requests, sending the browser to the
+// login page when it asks for the UI
+func authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requiresAuth(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, ok := authenticate(r)
+		if !ok {
+			if strings.HasPrefix(r.URL.Path, "/web/") {
+				http.Redirect(w, r, "/login", http.StatusFound)
+				return
+			}
+			writeAPIError(w, http.StatusUnauthorized, codeUnauthorized, "Authentication required")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+	})
+}
+
+// auth serves the login page and the session of the web UI
+type auth struct {
+}
+
+func (a auth) registerRoutes(r *mux.Router) {
+	r.HandleFunc("/login", a.handleLoginPage).Methods("GET")
+	r.HandleFunc("/login", a.handleLogin).Methods("POST")
+	r.HandleFunc("/web/logout", a.handleLogout)
+	r.HandleFunc("/api/session", a.handleSession).Methods("GET")
+	r.HandleFunc("/api/session", handleMethodNotAllowed)
+}
+
+func (a auth) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	page("login.html").Execute(w, r.URL.Query().Get("failed") != "")
+}
+
+func (a auth) handleLogin(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("username")
+	user, ok := checkPassword(name, r.FormValue("password"))
+	if !ok {
+		log.Printf("Failed login of user %v from %v", name, r.RemoteAddr)
+		http.Redirect(w, r, "/login?failed=1", http.StatusSeeOther)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    sessions.create(user.Name),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/web/", http.StatusSeeOther)
+}
+
+func (a auth) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		sessions.remove(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (a auth) handleSession(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, requestUser(r))
+}
@@ -0,0 +1,276 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+	xr "github.com/nleiva/xrgrpc"
+	"github.com/sfloresk/tviewer/model"
+	"google.golang.org/grpc"
+	grpccredentials "google.golang.org/grpc/credentials"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var certExpiryWarning = flag.Duration("cert-expiry-warning", 30 * 24 * time.Hour, "flag device certificates that expire within this time")
+
+// Name in the gRPC server certificate of IOS XR routers, as checked by xrgrpc
+const xrServerName = "ems.cisco.com"
+
+// parseCertificates parses every block of a PEM certificate or chain. field
+// names the certificate in errors. Expired certificates are parsed too, see
+// checkNotExpired.
+func parseCertificates(text string, field string) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	rest := []byte(text)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, newServiceError(errorInvalid, "%v block %v is a %v, expected a CERTIFICATE", field, len(certificates) + 1, block.Type)
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, newServiceError(errorInvalid, "%v block %v cannot be parsed: %v", field, len(certificates) + 1, err)
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, newServiceError(errorInvalid, "%v is not PEM encoded", field)
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return nil, newServiceError(errorInvalid, "%v has data after the last PEM block", field)
+	}
+	return certificates, nil
+}
+
+// validateCertificate checks that a CA certificate or chain is PEM encoded
+func validateCertificate(certificate string) error {
+	_, err := parseCertificates(certificate, "Certificate")
+	return err
+}
+
+// checkNotExpired checks that none of the certificates of text expired
+func checkNotExpired(text string, field string) error {
+	certificates, err := parseCertificates(text, field)
+	if err != nil {
+		return err
+	}
+	for _, certificate := range certificates {
+		if time.Now().After(certificate.NotAfter) {
+			return newServiceError(errorInvalid, "%v %v expired on %v", field, certificate.Subject, certificate.NotAfter.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// checkNewCertificates rejects the expired certificates of the device that
+// are not those of current, the stored device. Stored certificates that
+// expired are kept, so the device is still flagged and can be updated.
+func checkNewCertificates(device model.Device, current model.Device) error {
+	if device.Certificate != "" && device.Certificate != current.Certificate {
+		if err := checkNotExpired(device.Certificate, "Certificate"); err != nil {
+			return err
+		}
+	}
+	if device.ClientCertificate != "" && device.ClientCertificate != current.ClientCertificate {
+		if err := checkNotExpired(device.ClientCertificate, "Client certificate"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateClientKeyPair checks that the client key is PEM encoded and matches
+// the client certificate
+func validateClientKeyPair(device model.Device) error {
+	if _, err := tls.X509KeyPair([]byte(device.ClientCertificate), []byte(device.ClientKey)); err != nil {
+		return newServiceError(errorInvalid, "Client key does not match the client certificate: %v", err)
+	}
+	return nil
+}
+
+func certificateInfo(certificate *x509.Certificate) model.CertificateInfo {
+	info := model.CertificateInfo{
+		Subject:   certificate.Subject.String(),
+		Issuer:    certificate.Issuer.String(),
+		NotBefore: certificate.NotBefore,
+		NotAfter:  certificate.NotAfter,
+		IsCA:      certificate.IsCA,
+	}
+	info.SANs = append(info.SANs, certificate.DNSNames...)
+	for _, ip := range certificate.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+	info.SANs = append(info.SANs, certificate.EmailAddresses...)
+	for _, uri := range certificate.URIs {
+		info.SANs = append(info.SANs, uri.String())
+	}
+	return info
+}
+
+// describeCertificates sets the certificate details stored with the device.
+// The certificates must have been validated.
+func describeCertificates(device model.Device) model.Device {
+	device.CertificateInfo = nil
+	device.ClientCertificateInfo = nil
+	device.CertificateExpiry = nil
+
+	expiry := func(info model.CertificateInfo) {
+		if device.CertificateExpiry == nil || info.NotAfter.Before(*device.CertificateExpiry) {
+			notAfter := info.NotAfter
+			device.CertificateExpiry = &notAfter
+		}
+	}
+	if certificates, err := parseCertificates(device.Certificate, "Certificate"); err == nil {
+		for _, certificate := range certificates {
+			info := certificateInfo(certificate)
+			device.CertificateInfo = append(device.CertificateInfo, info)
+			expiry(info)
+		}
+	}
+	if device.ClientCertificate != "" {
+		if certificates, err := parseCertificates(device.ClientCertificate, "Client certificate"); err == nil {
+			info := certificateInfo(certificates[0])
+			device.ClientCertificateInfo = &info
+			expiry(info)
+		}
+	}
+	return device
+}
+
+// certificateExpiring tells whether a certificate of the device expires
+// within -cert-expiry-warning
+func certificateExpiring(device model.Device) bool {
+	return device.CertificateExpiry != nil && time.Until(*device.CertificateExpiry) < *certExpiryWarning
+}
+
+// writeCertificate writes the CA certificate of the device where the
+// connections read it. Only tviewer can read it.
+func writeCertificate(device model.Device) error {
+	err := ioutil.WriteFile(certPath(device.Name), []byte(device.Certificate), 0600)
+	if err != nil {
+		return fmt.Errorf("cannot create cert file: %v", err)
+	}
+	return nil
+}
+
+// loginCredentials sends the username and password with every call, as
+// xrgrpc does
+type loginCredentials struct {
+	username string
+	password string
+}
+
+func (c loginCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"username": c.username, "password": c.password}, nil
+}
+
+func (c loginCredentials) RequireTransportSecurity() bool {
+	return true
+}
+
+// dialRouter connects to a router like xr.Connect, presenting the client
+// certificate when there is one. The returned context expires after timeout
+// seconds.
+func dialRouter(host string, username string, password string, caFile string, clientCertificate string, clientKey string, timeout int) (*grpc.ClientConn, context.Context, error) {
+	if clientCertificate == "" {
+		router, err := xr.BuildRouter(
+			xr.WithUsername(username),
+			xr.WithPassword(password),
+			xr.WithHost(host),
+			xr.WithCert(caFile),
+			xr.WithTimeout(timeout),
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("target parameters are incorrect: %v", err)
+		}
+		return xr.Connect(*router)
+	}
+
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, nil, fmt.Errorf("no certificate found in %v", caFile)
+	}
+	pair, err := tls.X509KeyPair([]byte(clientCertificate), []byte(clientKey))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid client certificate: %v", err)
+	}
+	tlsConfig := &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{pair},
+		ServerName:   xrServerName,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout) * time.Second)
+	// The context is used by later calls, it is released when it expires
+	time.AfterFunc(time.Duration(timeout) * time.Second, cancel)
+	conn, err := grpc.DialContext(ctx, host,
+		grpc.WithTransportCredentials(grpccredentials.NewTLS(tlsConfig)),
+		grpc.WithPerRPCCredentials(loginCredentials{username: username, password: password}),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, ctx, nil
+}
+
+// describeStoredCertificates stores the certificate details of devices saved
+// by older versions and logs the certificates that expire soon
+func describeStoredCertificates(devices []model.Device) error {
+	session, dbCollection, err := openDevicesCollection()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	for _, device := range devices {
+		if device.CertificateExpiry == nil {
+			device = describeCertificates(device)
+			err = dbCollection.Update(bson.M{"name": device.Name}, bson.M{"$set": bson.M{
+				"certificateinfo":       device.CertificateInfo,
+				"clientcertificateinfo": device.ClientCertificateInfo,
+				"certificateexpiry":     device.CertificateExpiry,
+			}})
+			if err != nil {
+				return fmt.Errorf("cannot update device table: %v", err)
+			}
+		}
+		if certificateExpiring(device) && time.Now().After(*device.CertificateExpiry) {
+			log.Printf("A certificate of device %v expired on %v", device.Name, device.CertificateExpiry.Format(time.RFC3339))
+		} else if certificateExpiring(device) {
+			log.Printf("A certificate of device %v expires on %v", device.Name, device.CertificateExpiry.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
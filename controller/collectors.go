@@ -0,0 +1,130 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"context"
+	"sync"
+	"github.com/sfloresk/tviewer/model"
+)
+
+// collectorRegistry keeps track of the collectors running for each device so
+// they can be restarted or stopped one device at a time
+type collectorRegistry struct {
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+	// Collector goroutines still running, cancelled or not
+	active  sync.WaitGroup
+	// Subscriptions that received data and are still open
+	streams int
+	// Generation of the last collectors started
+	generation uint64
+}
+
+var collectors = collectorRegistry{running: make(map[string]context.CancelFunc)}
+
+// start starts streaming interface and ISIS telemetry from the device,
+// stopping any collectors already running for it. Nothing is started once
+// tviewer is shutting down.
+func (c *collectorRegistry) start(device model.Device, telemetryChannel chan model.TelemetryWrapper) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c.mu.Lock()
+	select {
+	case <-shuttingDown:
+		c.mu.Unlock()
+		cancel()
+		return
+	default:
+	}
+	if previous, ok := c.running[device.Name]; ok {
+		previous()
+	}
+	c.running[device.Name] = cancel
+	c.active.Add(3)
+	c.generation++
+	generation := c.generation
+	c.mu.Unlock()
+
+	n := Node{}
+	n.Ip = device.Ip
+	n.CertName = certPath(device.Name)
+	n.Name = device.Name
+	n.Username = device.Username
+	n.Password = device.Password
+	n.Port = device.Port
+	n.ClientCertificate = device.ClientCertificate
+	n.ClientKey = device.ClientKey
+	n.Generation = generation
+	n.Telemetry = deviceTelemetryIDs(device)
+
+	go func() {
+		defer c.active.Done()
+		n.CollectInterfaceData(ctx, telemetryChannel)
+	}()
+	go func() {
+		defer c.active.Done()
+		n.CollectISISData(ctx, telemetryChannel)
+	}()
+	go func() {
+		defer c.active.Done()
+		n.watchForOldData(ctx, telemetryChannel)
+	}()
+}
+
+// stopAll cancels the collectors of every device, on shutdown
+func (c *collectorRegistry) stopAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, cancel := range c.running {
+		cancel()
+		delete(c.running, name)
+	}
+}
+
+// stop cancels the collectors of the device, if any
+func (c *collectorRegistry) stop(deviceName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cancel, ok := c.running[deviceName]; ok {
+		cancel()
+		delete(c.running, deviceName)
+	}
+}
+
+// streamStarted and streamEnded count the subscriptions that are streaming
+func (c *collectorRegistry) streamStarted() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.streams++
+	metricCollectorsStreaming.Set(float64(c.streams))
+}
+
+func (c *collectorRegistry) streamEnded() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.streams--
+	metricCollectorsStreaming.Set(float64(c.streams))
+}
+
+// streaming returns the number of subscriptions that are streaming
+func (c *collectorRegistry) streaming() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.streams
+}
@@ -18,7 +18,9 @@
 package controller
 
 import (
+	"flag"
 	"html/template"
+	"io/fs"
 	"net/http"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
@@ -28,47 +30,61 @@ import (
 	"log"
 )
 
-const basePath = "src/github.com/sfloresk/tviewer"
-const ifSubscriptionID = "tviewerIFCS"
-const isisSubscriptionID = "tviewerISIS"
-const ifSensorGroupID = "tviewerInterfaces"
-const isisSensorGroupID = "tviewerISISNeighbor"
-const sampleInterval = 2000
-
 var (
 	indexController index
 	homeController home
 	topologyController topology
 	devicesController devices
+	profilesController profiles
+	authController auth
+	usersController users
+	auditController auditLog
+	configController configuration
+	healthController health
 )
 
 func Startup(templates map[string]*template.Template, r *mux.Router) {
 	// Create cert directory if doesn't exist
 
-	_ = os.Mkdir(basePath + "/certs", os.ModePerm)
+	_ = os.Mkdir(currentConfig().BasePath + "/certs", os.ModePerm)
 
 	// Create the channel
 	telemetryChan := make(chan model.TelemetryWrapper)
 
-	indexController.indexTemplate = templates["index.html"]
+	SetTemplates(templates)
+
+	// Everything but the login page and the static assets needs a user
+	r.Use(authMiddleware)
+
+	authController.registerRoutes(r)
+
+	usersController.registerRoutes(r)
+
+	auditController.registerRoutes(r)
+
+	configController.registerRoutes(r)
+
+	healthController.registerRoutes(r)
+
 	indexController.registerRoutes(r)
 
-	homeController.homeTemplate = templates["home.html"]
 	homeController.registerRoutes(r)
 
-	devicesController.devicesTemplate = templates["devices.html"]
 	devicesController.telemetryChannel = telemetryChan
+	devicesController.wsUpgrader = websocket.Upgrader{}
 	devicesController.registerRoutes(r)
 
-	topologyController.topologyTemplate = templates["topology.html"]
-	topologyController.clients = make(map[*websocket.Conn]bool)
-	topologyController.broadcast = make(chan model.Topology)
+	profilesController.telemetryChannel = telemetryChan
+	profilesController.registerRoutes(r)
+
+	topologyController.hub = newHub()
 	topologyController.wsUpgrader = websocket.Upgrader{}
+	topologyController.telemetryChannel = telemetryChan
 	topologyController.registerRoutes(r)
 
 	// Start telemetry of devices that are in the database
 	// Open database
-	session, err := mgo.Dial(os.Getenv("TELEMETRY_DB"))
+	session, err := mgo.Dial(currentConfig().Database)
 	if err != nil {
 		log.Fatal("Cannot open database:" + err.Error() + "\n")
 	}
@@ -77,33 +93,70 @@ func Startup(templates map[string]*template.Template, r *mux.Router) {
 	// Switch the session to a monotonic behavior.
 	session.SetMode(mgo.Monotonic, true)
 
-	dbCollection := session.DB("Telemetry").C("Devices")
-
-	var devices []model.Device
+	// Secrets are encrypted at rest
+	err = loadMasterKey()
+	if err != nil {
+		log.Fatal("Cannot load master key: " + err.Error() + "\n")
+	}
+	err = migrateSecrets()
+	if err != nil {
+		log.Fatal("Cannot encrypt stored secrets: " + err.Error() + "\n")
+	}
+	err = bootstrapAdmin()
+	if err != nil {
+		log.Fatal("Cannot create admin user: " + err.Error() + "\n")
+	}
 
-	err = dbCollection.Find(nil).All(&devices)
+	devices, err := listDevices()
 	if err != nil {
 		log.Fatal("Cannot read devices table:" + err.Error() + "\n")
 	}
+	err = describeStoredCertificates(devices)
+	if err != nil {
+		log.Fatal("Cannot read device certificates: " + err.Error() + "\n")
+	}
+	err = pinStoredTelemetryIDs(devices)
+	if err != nil {
+		log.Fatal("Cannot store device telemetry settings: " + err.Error() + "\n")
+	}
+	// Clean database from previous data. Collectors restarted later on, e.g.
+	// when a device is updated, keep what was collected
+	session.DB(currentConfig().DatabaseName).C("Interfaces").RemoveAll(nil)
+	session.DB(currentConfig().DatabaseName).C("ISIS").RemoveAll(nil)
+
 	for _, device := range devices {
-		n := Node{}
-		n.Ip = device.Ip
-		n.CertName = basePath + "/certs/" + device.Name + ".pem"
-		n.Name = device.Name
-		n.Username = device.Username
-		n.Password = device.Password
-		n.Port = device.Port
-
-		go n.CollectInterfaceData(telemetryChan)
-		go n.CollectISISData(telemetryChan)
-		go n.watchForOldData(telemetryChan)
+		// Certificate files are rebuilt from the database, so they follow
+		// the base path when it changes
+		err = writeCertificate(device)
+		if err != nil {
+			log.Printf("Device %v: %v", device.Name, err)
+		}
+		collectors.start(device, telemetryChan)
 	}
 
 
 	// Start listening for collection
+	go topologyController.hub.run()
 	go topologyController.watchTopologyChanges(telemetryChan)
+	go sweepSessions()
 
-	r.PathPrefix("/").Handler(http.FileServer(http.Dir(basePath + "/public")))
+	flag.Parse()
+	err = loadServerTLS()
+	if err != nil {
+		log.Fatal("Cannot load TLS certificate: " + err.Error() + "\n")
+	}
+	if *importFile != "" {
+		importInventoryFile(*importFile, *importSkipExisting, telemetryChan)
+	}
+	if currentConfig().NetboxURL != "" {
+		go runInventorySync(telemetryChan)
+	}
+
+	public, err := fs.Sub(assets, "public")
+	if err != nil {
+		log.Fatal("Cannot read static assets: " + err.Error() + "\n")
+	}
+	r.PathPrefix("/").Handler(http.FileServer(http.FS(public)))
 
 }
 
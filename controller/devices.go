@@ -18,22 +18,16 @@
 package controller
 
 import (
-	"html/template"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"github.com/gorilla/mux"
-	"encoding/json"
+	"github.com/gorilla/websocket"
 	"github.com/sfloresk/tviewer/model"
-	"log"
-	"gopkg.in/mgo.v2"
-	"os"
-	"gopkg.in/mgo.v2/bson"
-	"io/ioutil"
 	"flag"
-	"bytes"
-	xr "github.com/nleiva/xrgrpc"
 )
 
-var templ = flag.String("bt", basePath + "/oc-templates/oc-telemetry.json", "Telemetry Config Template")
+var templ = flag.String("bt", "", "Telemetry Config Template (default: the embedded oc-templates/oc-telemetry.json)")
 
 // NeighborConfig uses asplain notation for AS numbers (RFC5396)
 type TelemetryConfig struct {
@@ -43,229 +37,212 @@ type TelemetryConfig struct {
 	SampleInterval int
 }
 
+// maxInventorySize limits the inventories posted to /api/devices/import
+const maxInventorySize = 10 << 20
+
 type devices struct {
-	devicesTemplate  *template.Template
 	telemetryChannel chan model.TelemetryWrapper
+	wsUpgrader       websocket.Upgrader
 }
 
 func (d devices) registerRoutes(r *mux.Router) {
-	r.HandleFunc("/ng/devices", d.handleDashboard)
-	r.HandleFunc("/api/device", d.handleApiDevice)
-
+	r.HandleFunc("/ng/devices", requireRole(roleOperator, d.handleDashboard))
+
+	r.HandleFunc("/api/devices", requireRole(roleOperator, d.handleListDevices)).Methods("GET")
+	r.HandleFunc("/api/devices", requireRole(roleAdmin, d.handleCreateDevice)).Methods("POST")
+	r.HandleFunc("/api/devices", handleMethodNotAllowed)
+	r.HandleFunc("/api/devices/import", requireRole(roleAdmin, d.handleImportDevices)).Methods("POST")
+	r.HandleFunc("/api/devices/import", handleMethodNotAllowed)
+	r.HandleFunc("/api/devices/{name}", requireRole(roleOperator, d.handleGetDevice)).Methods("GET")
+	r.HandleFunc("/api/devices/{name}", requireRole(roleAdmin, d.handleReplaceDevice)).Methods("PUT")
+	r.HandleFunc("/api/devices/{name}", requireRole(roleAdmin, d.handlePatchDevice)).Methods("PATCH")
+	r.HandleFunc("/api/devices/{name}", requireRole(roleAdmin, d.handleDeleteDevice)).Methods("DELETE")
+	r.HandleFunc("/api/devices/{name}", handleMethodNotAllowed)
+	r.HandleFunc("/api/devices/{name}/restart", requireRole(roleOperator, d.handleRestartDevice)).Methods("POST")
+	r.HandleFunc("/api/devices/{name}/restart", handleMethodNotAllowed)
+	r.HandleFunc("/api/inventory/sync", requireRole(roleOperator, d.handleGetInventorySync)).Methods("GET")
+	r.HandleFunc("/api/inventory/sync", requireRole(roleAdmin, d.handleInventorySync)).Methods("POST")
+	r.HandleFunc("/api/inventory/sync", handleMethodNotAllowed)
+	r.HandleFunc("/api/jobs", requireRole(roleOperator, d.handleListJobs)).Methods("GET")
+	r.HandleFunc("/api/jobs", handleMethodNotAllowed)
+	r.HandleFunc("/api/jobs/{id}", requireRole(roleOperator, d.handleGetJob)).Methods("GET")
+	r.HandleFunc("/api/jobs/{id}", handleMethodNotAllowed)
+	r.HandleFunc("/ws/jobs", requireRole(roleOperator, d.handleJobsSocket))
+	r.HandleFunc("/api/openapi.json", requireRole(roleViewer, handleOpenAPI)).Methods("GET")
 }
 
 func (d devices) handleDashboard(w http.ResponseWriter, r *http.Request) {
-	d.devicesTemplate.Execute(w, nil)
+	page("devices.html").Execute(w, nil)
 }
 
-func (d devices) handleApiDevice(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "POST":
-		dec := json.NewDecoder(r.Body)
-		var device *model.Device = &model.Device{}
-		err := dec.Decode(device)
-
-		if err != nil {
-			log.Print(err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		// Open database
-		session, err := mgo.Dial(os.Getenv("TELEMETRY_DB"))
-		if err != nil {
-			log.Print("Cannot open database:" + err.Error() + "\n")
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
-			return
-		}
-		defer session.Close()
-
-		// Switch the session to a monotonic behavior.
-		session.SetMode(mgo.Monotonic, true)
-
-		dbCollection := session.DB("Telemetry").C("Devices")
-
-		// Check if the name has been used before
-		count, err := dbCollection.Find(bson.M{"name": device.Name}).Count()
-		if err != nil {
-			log.Print("Cannot read device table:" + err.Error() + "\n")
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
-			return
-		}
-		if (count > 0) {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("Name " + device.Name + " already in use"))
-			return
-		}
-
-		// Check if the ip has been used before
-		count, err = dbCollection.Find(bson.M{"ip": device.Ip}).Count()
-		if err != nil {
-			log.Print("Cannot read device table:" + err.Error() + "\n")
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
-			return
-		}
-		if (count > 0) {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("IP " + device.Ip + " already in use"))
-			return
-		}
-
-		// Insert new device in Database
-		dbCollection.Insert(&device)
-
-		// Create certificate
-		content := []byte(device.Certificate)
-
-		err = ioutil.WriteFile(basePath + "/certs/" + device.Name + ".pem", content, 0644)
-		if err != nil {
-			log.Print("Cannot create cert file:" + err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
-			return
-		}
-
-		flag.Parse()
-
-		router, err := xr.BuildRouter(
-			xr.WithUsername(device.Username),
-			xr.WithPassword(device.Password),
-			xr.WithHost(device.Ip + ":" + device.Port),
-			xr.WithCert(basePath + "/certs/" + device.Name + ".pem"),
-			xr.WithTimeout(15),
-		)
-		if err != nil {
-			log.Print("Target parameters for device are incorrect:" + err.Error() + "\n")
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
-			return
-		}
-
-		// Define Telemetry parameters for interfaces
-		tConfigInterfaces := &TelemetryConfig{
-			SensorGroupID:         ifSensorGroupID,
-			Path:          "Cisco-IOS-XR-fib-common-oper:fib/nodes/node/protocols/protocol/vrfs/vrf/interface-infos/interface-info/interfaces/interface",
-			SubscriptionID:     ifSubscriptionID,
-			SampleInterval: sampleInterval,
-		}
-
-		// Define Telemetry parameters for ISIS
-		tConfigISIS := &TelemetryConfig{
-			SensorGroupID:         isisSensorGroupID,
-			Path:          "Cisco-IOS-XR-clns-isis-oper:isis/instances/instance/neighbors/neighbor",
-			SubscriptionID:     isisSubscriptionID,
-			SampleInterval: sampleInterval,
-		}
-
-		// Determine the ID for config.
-		var id int64 = 1000
-
-		// Read the OC Telemetry template file
-		t, err := template.ParseFiles(*templ)
+func (d devices) handleListDevices(w http.ResponseWriter, r *http.Request) {
+	devices, err := listDevices()
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, redactDevices(devices))
+}
 
-		// 'buf' is an io.Writter to capture the template execution output for each device
-		buf1 := new(bytes.Buffer)
-		err = t.Execute(buf1, tConfigInterfaces)
-		if err != nil {
-			log.Printf("Could not execute interface telemetry config for router: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
-			return
-		}
-		// Connect to router
-		conn1, ctx1, err := xr.Connect(*router)
+func (d devices) handleCreateDevice(w http.ResponseWriter, r *http.Request) {
+	var device model.Device
+	if !decodeJSONBody(w, r, &device) {
+		return
+	}
 
+	// ?dryRun=true previews the onboarding without changing anything
+	if r.URL.Query().Get("dryRun") == "true" {
+		result, err := dryRunOnboarding(device)
 		if err != nil {
-			log.Printf("could not setup a client connection to %s, %v", router.Host, err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
+			writeServiceError(w, err)
 			return
 		}
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
 
-		// Apply the template+parameters to the router.
-		_, err = xr.MergeConfig(ctx1, conn1, buf1.String(), id)
-		if err != nil {
-			log.Fatalf("Failed to config %s: %v\n", router.Host, err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
-			return
-		}
+	// Onboarding runs in the background, follow it at /api/jobs/{id} or /ws/jobs
+	job, err := startOnboarding(device, d.telemetryChannel, requestUser(r).Name)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
 
-		buf1 = new(bytes.Buffer)
-		err = t.Execute(buf1, tConfigISIS)
+	w.Header().Set("Location", "/api/jobs/" + job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
 
-		_, err = xr.MergeConfig(ctx1, conn1, buf1.String(), id + 1)
-		if err != nil {
-			log.Printf("failed to config %s: %v\n", router.Host, err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
-			return
-		}
+// handleImportDevices onboards every device of a CSV or YAML inventory sent
+// as the body. The format comes from ?format= or the content type.
+func (d devices) handleImportDevices(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxInventorySize)
+	raw, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, "Cannot read body: " + err.Error())
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = inventoryFormat("", r.Header.Get("Content-Type"))
+	}
+	inv, err := parseInventory(raw, format)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
 
-		conn1.Close()
+	// Certificates come inline or from a profile, files of the server are
+	// not read
+	results := importInventory(inv, "", r.URL.Query().Get("skipExisting") == "true", d.telemetryChannel, requestUser(r).Name)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+}
 
-		n := Node{}
-		n.Ip = device.Ip
-		n.CertName = basePath + "/certs/" + device.Name + ".pem"
-		n.Name = device.Name
-		n.Username = device.Username
-		n.Password = device.Password
-		n.Port = device.Port
+func (d devices) handleGetDevice(w http.ResponseWriter, r *http.Request) {
+	device, err := getDevice(mux.Vars(r)["name"])
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, redactDevice(device))
+}
 
-		go n.CollectInterfaceData(d.telemetryChannel)
-		go n.CollectISISData(d.telemetryChannel)
-		go n.watchForOldData(d.telemetryChannel)
+func (d devices) handleReplaceDevice(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	var device model.Device
+	if !decodeJSONBody(w, r, &device) {
+		return
+	}
+	d.update(w, r, name, device)
+}
 
-		w.Write([]byte("ok"))
-		break
-	case "GET":
-		var devices []model.Device
+func (d devices) handlePatchDevice(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	var patch devicePatch
+	if !decodeJSONBody(w, r, &patch) {
+		return
+	}
+	device, err := getDevice(name)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	d.update(w, r, name, patch.apply(device))
+}
 
-		// Open database
-		session, err := mgo.Dial(os.Getenv("TELEMETRY_DB"))
-		if err != nil {
-			log.Fatalf("Cannot open database: %v\n", err)
-		}
-		defer session.Close()
+func (d devices) update(w http.ResponseWriter, r *http.Request, name string, device model.Device) {
+	err := updateDevice(name, device, d.telemetryChannel, requestUser(r).Name)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	device, err = getDevice(name)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, redactDevice(device))
+}
 
-		// Switch the session to a monotonic behavior.
-		session.SetMode(mgo.Monotonic, true)
-		dbCollection := session.DB("Telemetry").C("Devices")
+func (d devices) handleDeleteDevice(w http.ResponseWriter, r *http.Request) {
+	err := deleteDevice(mux.Vars(r)["name"], d.telemetryChannel, requestUser(r).Name)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-		err = dbCollection.Find(nil).All(&devices)
-		if err != nil {
-			panic(err)
-		}
-		enc := json.NewEncoder(w)
-		enc.Encode(devices)
+// handleRestartDevice restarts the collectors of the device, e.g. after the
+// router was reloaded
+func (d devices) handleRestartDevice(w http.ResponseWriter, r *http.Request) {
+	err := restartCollectors(mux.Vars(r)["name"], d.telemetryChannel, requestUser(r).Name)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-		break;
-	case "DELETE":
-		deviceName := r.URL.Query().Get("name")
-		// Open database
-		session, err := mgo.Dial(os.Getenv("TELEMETRY_DB"))
-		if err != nil {
-			log.Fatalf("Cannot open database: %v\n", err)
-		}
-		defer session.Close()
+// handleGetInventorySync returns the report of the last inventory sync
+func (d devices) handleGetInventorySync(w http.ResponseWriter, r *http.Request) {
+	report := netboxSync.lastReport()
+	if report == nil {
+		writeAPIError(w, http.StatusNotFound, codeNotFound, "No inventory sync has run")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
 
-		// Switch the session to a monotonic behavior.
-		session.SetMode(mgo.Monotonic, true)
-		dbCollection := session.DB("Telemetry").C("Devices")
+// handleInventorySync syncs now instead of waiting for the next interval
+func (d devices) handleInventorySync(w http.ResponseWriter, r *http.Request) {
+	if currentConfig().NetboxURL == "" {
+		writeAPIError(w, http.StatusConflict, codeConflict, "Inventory sync is not configured, see -netbox-url")
+		return
+	}
+	writeJSON(w, http.StatusOK, netboxSync.sync(d.telemetryChannel))
+}
 
-		err = dbCollection.Remove(bson.M{"name": deviceName})
+func (d devices) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, jobs.list())
+}
 
-		if err != nil {
-			log.Fatalf("Cannot delete data in device table: %v\n", err)
-		}
-		w.Write([]byte("ok"))
+func (d devices) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := jobs.get(mux.Vars(r)["id"])
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
 
-		break;
-	default:
-		w.WriteHeader(http.StatusBadRequest)
-		break
+// handleJobsSocket sends the current jobs and then every change to them
+func (d devices) handleJobsSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := d.wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Cannot upgrade websocket connection: %v", err)
+		return
 	}
-}
\ No newline at end of file
+	websockets.Add(1)
+	metricWebsocketClients.WithLabelValues("jobs").Inc()
+	go serveJobs(ws)
+}
@@ -0,0 +1,713 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+	xr "github.com/nleiva/xrgrpc"
+	"github.com/sfloresk/tviewer/model"
+	"google.golang.org/grpc"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Device operations shared by the REST and gRPC APIs
+
+type errorKind int
+
+const (
+	errorInternal errorKind = iota
+	errorInvalid
+	errorNotFound
+	errorConflict
+	// Some steps of the operation failed, details holds the outcome of each
+	errorPartial
+)
+
+// serviceError tells the API layers how to report a failure
+type serviceError struct {
+	kind    errorKind
+	message string
+	details interface{}
+}
+
+func (e *serviceError) Error() string {
+	return e.message
+}
+
+func newServiceError(kind errorKind, format string, args ...interface{}) error {
+	return &serviceError{kind: kind, message: fmt.Sprintf(format, args...)}
+}
+
+// kindOf returns the kind of err, errorInternal for errors from other packages
+func kindOf(err error) errorKind {
+	if serr, ok := err.(*serviceError); ok {
+		return serr.kind
+	}
+	return errorInternal
+}
+
+// Device names end up in certificate file names
+var deviceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Names taken by other routes under /api/devices/
+var reservedDeviceNames = map[string]bool{
+	"import": true,
+}
+
+func validateDevice(device model.Device) error {
+	if device.Name == "" || device.Ip == "" || device.Port == "" {
+		return newServiceError(errorInvalid, "Name, IP and port are required")
+	}
+	if !deviceNamePattern.MatchString(device.Name) {
+		return newServiceError(errorInvalid, "Name %v can only contain letters, digits, '.', '_' and '-'", device.Name)
+	}
+	if reservedDeviceNames[device.Name] {
+		return newServiceError(errorInvalid, "Name %v is reserved", device.Name)
+	}
+	if port, err := strconv.Atoi(device.Port); err != nil || port < 1 || port > 65535 {
+		return newServiceError(errorInvalid, "Port %v is not a valid TCP port", device.Port)
+	}
+	if device.SampleInterval < 0 {
+		return newServiceError(errorInvalid, "Sample interval cannot be negative")
+	}
+	if device.Certificate != "" {
+		if err := validateCertificate(device.Certificate); err != nil {
+			return err
+		}
+	}
+	if device.ClientCertificate != "" {
+		if _, err := parseCertificates(device.ClientCertificate, "Client certificate"); err != nil {
+			return err
+		}
+	}
+	if device.ClientKey != "" {
+		if device.ClientCertificate == "" {
+			return newServiceError(errorInvalid, "Client key given without a client certificate")
+		}
+		if err := validateClientKeyPair(device); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deviceSampleInterval is the telemetry sample interval configured on the
+// device, or else the default when it was onboarded
+func deviceSampleInterval(device model.Device) int {
+	if device.SampleInterval == 0 {
+		return deviceTelemetryIDs(device).SampleInterval
+	}
+	return device.SampleInterval
+}
+
+// configuredTelemetryIDs returns the telemetry settings new devices get
+func configuredTelemetryIDs() model.TelemetryIDs {
+	config := currentConfig()
+	return model.TelemetryIDs{
+		InterfaceSubscriptionID: config.InterfaceSubscriptionID,
+		ISISSubscriptionID:      config.ISISSubscriptionID,
+		InterfaceSensorGroupID:  config.InterfaceSensorGroupID,
+		ISISSensorGroupID:       config.ISISSensorGroupID,
+		SampleInterval:          config.SampleInterval,
+	}
+}
+
+// deviceTelemetryIDs returns the telemetry settings pushed to the device.
+// Devices that are not onboarded yet get the configured ones.
+func deviceTelemetryIDs(device model.Device) model.TelemetryIDs {
+	if device.Telemetry == nil {
+		return configuredTelemetryIDs()
+	}
+	return *device.Telemetry
+}
+
+// pinStoredTelemetryIDs stores the configured telemetry settings with the
+// devices saved by older versions, which were onboarded with them
+func pinStoredTelemetryIDs(devices []model.Device) error {
+	session, dbCollection, err := openDevicesCollection()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	for i := range devices {
+		if devices[i].Telemetry != nil {
+			continue
+		}
+		ids := configuredTelemetryIDs()
+		err = dbCollection.Update(bson.M{"name": devices[i].Name}, bson.M{"$set": bson.M{"telemetry": &ids}})
+		if err != nil {
+			return fmt.Errorf("cannot update device table: %v", err)
+		}
+		devices[i].Telemetry = &ids
+	}
+	return nil
+}
+
+func openDevicesCollection() (*mgo.Session, *mgo.Collection, error) {
+	session, err := mgo.Dial(currentConfig().Database)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open database: %v", err)
+	}
+
+	// Switch the session to a monotonic behavior.
+	session.SetMode(mgo.Monotonic, true)
+
+	return session, session.DB(currentConfig().DatabaseName).C("Devices"), nil
+}
+
+func listDevices() ([]model.Device, error) {
+	session, dbCollection, err := openDevicesCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	devices := make([]model.Device, 0)
+	err = dbCollection.Find(nil).All(&devices)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read devices table: %v", err)
+	}
+	for i := range devices {
+		if devices[i], err = openDevice(devices[i]); err != nil {
+			return nil, err
+		}
+	}
+	return devices, nil
+}
+
+func getDevice(name string) (model.Device, error) {
+	var device model.Device
+
+	session, dbCollection, err := openDevicesCollection()
+	if err != nil {
+		return device, err
+	}
+	defer session.Close()
+
+	err = dbCollection.Find(bson.M{"name": name}).One(&device)
+	if err == mgo.ErrNotFound {
+		return device, newServiceError(errorNotFound, "Device %v not found", name)
+	}
+	if err != nil {
+		return device, fmt.Errorf("cannot read devices table: %v", err)
+	}
+	return openDevice(device)
+}
+
+// addDevice onboards the device, see onboardDevice, and starts its collectors
+func addDevice(device model.Device, telemetryChannel chan model.TelemetryWrapper, actor string) (model.Device, error) {
+	device, err := onboardDevice(device, actor)
+	if err != nil {
+		return device, err
+	}
+
+	collectors.start(device, telemetryChannel)
+	return device, nil
+}
+
+// restartCollectors starts the collectors of the device again
+func restartCollectors(name string, telemetryChannel chan model.TelemetryWrapper, actor string) (err error) {
+	defer func() {
+		recordAudit(actor, auditDeviceRestart, name, "", err)
+	}()
+
+	device, err := getDevice(name)
+	if err != nil {
+		return err
+	}
+	log.Printf("Restarting collectors of %v", name)
+	collectors.start(device, telemetryChannel)
+	return nil
+}
+
+// checkDeviceUnique fails if the name or the IP of the device are in use
+func checkDeviceUnique(dbCollection *mgo.Collection, device model.Device) error {
+	// Check if the name has been used before
+	count, err := dbCollection.Find(bson.M{"name": device.Name}).Count()
+	if err != nil {
+		return fmt.Errorf("cannot read devices table: %v", err)
+	}
+	if (count > 0) {
+		return newServiceError(errorConflict, "Name %v already in use", device.Name)
+	}
+
+	// Check if the ip has been used before
+	count, err = dbCollection.Find(bson.M{"ip": device.Ip}).Count()
+	if err != nil {
+		return fmt.Errorf("cannot read devices table: %v", err)
+	}
+	if (count > 0) {
+		return newServiceError(errorConflict, "IP %v already in use", device.Ip)
+	}
+	return nil
+}
+
+// configureTelemetry merges the tviewer sensor groups and subscriptions into
+// the device configuration
+func configureTelemetry(device model.Device, actor string) error {
+	// Connect to router
+	conn1, err := connectDevice(device)
+	if err != nil {
+		return err
+	}
+	defer conn1.Close()
+
+	return mergeTelemetry(conn1, device, actor)
+}
+
+// removeTelemetry deletes the tviewer sensor groups and subscriptions from
+// the device configuration
+func removeTelemetry(device model.Device, actor string) error {
+	conn1, err := connectDevice(device)
+	if err != nil {
+		return err
+	}
+	defer conn1.Close()
+
+	return deleteTelemetry(conn1, device, actor)
+}
+
+// Indexes of the sensor groups in the rendered telemetry configs
+const (
+	ifTelemetryConfig = iota
+	isisTelemetryConfig
+)
+
+// mergeTelemetry applies the rendered telemetry configs on an open connection
+func mergeTelemetry(conn *grpc.ClientConn, device model.Device, actor string) error {
+	for _, index := range []int{ifTelemetryConfig, isisTelemetryConfig} {
+		if err := mergeTelemetryConfig(conn, device, index, actor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteTelemetry removes the rendered telemetry configs on an open connection
+func deleteTelemetry(conn *grpc.ClientConn, device model.Device, actor string) error {
+	for _, index := range []int{ifTelemetryConfig, isisTelemetryConfig} {
+		if err := deleteTelemetryConfig(conn, device, index, actor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeTelemetryConfig pushes one sensor group and records it in the audit log
+func mergeTelemetryConfig(conn *grpc.ClientConn, device model.Device, index int, actor string) error {
+	configs, err := renderTelemetryConfigs(device)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := deviceCallContext()
+	defer cancel()
+
+	// Apply the template+parameters to the router.
+	_, err = xr.MergeConfig(ctx, conn, configs[index], telemetryConfigID + int64(index))
+	recordAudit(actor, auditConfigMerge, device.Name, configHash(configs[index]), err)
+	if err != nil {
+		log.Printf("Failed to config %s: %v\n", device.Ip, err)
+		return err
+	}
+	return nil
+}
+
+func deleteTelemetryConfig(conn *grpc.ClientConn, device model.Device, index int, actor string) error {
+	configs, err := renderTelemetryConfigs(device)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := deviceCallContext()
+	defer cancel()
+
+	_, err = xr.DeleteConfig(ctx, conn, configs[index], telemetryConfigID + int64(index))
+	recordAudit(actor, auditConfigDelete, device.Name, configHash(configs[index]), err)
+	if err != nil {
+		log.Printf("Failed to remove config from %s: %v\n", device.Ip, err)
+		return err
+	}
+	return nil
+}
+
+// ID of the first telemetry config request, the next sensor group uses the next one
+const telemetryConfigID int64 = 1000
+
+// telemetryConfigs returns the template parameters of the interface and
+// ISIS sensor groups of the device
+func telemetryConfigs(device model.Device) []*TelemetryConfig {
+	ids := deviceTelemetryIDs(device)
+
+	// Define Telemetry parameters for interfaces
+	tConfigInterfaces := &TelemetryConfig{
+		SensorGroupID:         ids.InterfaceSensorGroupID,
+		Path:          "Cisco-IOS-XR-fib-common-oper:fib/nodes/node/protocols/protocol/vrfs/vrf/interface-infos/interface-info/interfaces/interface",
+		SubscriptionID:     ids.InterfaceSubscriptionID,
+		SampleInterval: deviceSampleInterval(device),
+	}
+
+	// Define Telemetry parameters for ISIS
+	tConfigISIS := &TelemetryConfig{
+		SensorGroupID:         ids.ISISSensorGroupID,
+		Path:          "Cisco-IOS-XR-clns-isis-oper:isis/instances/instance/neighbors/neighbor",
+		SubscriptionID:     ids.ISISSubscriptionID,
+		SampleInterval: deviceSampleInterval(device),
+	}
+
+	return []*TelemetryConfig{tConfigInterfaces, tConfigISIS}
+}
+
+// renderTelemetryConfigs executes the OC Telemetry template for the interface
+// and ISIS sensor groups of the device
+func renderTelemetryConfigs(device model.Device) ([]string, error) {
+	flag.Parse()
+
+	// Read the OC Telemetry template file
+	var t *template.Template
+	var err error
+	if *templ != "" {
+		t, err = template.ParseFiles(*templ)
+	} else {
+		t, err = template.ParseFS(assets, "oc-templates/oc-telemetry.json")
+	}
+	if err != nil {
+		log.Printf("Could not read telemetry config template: %v", err)
+		return nil, err
+	}
+
+	var configs []string
+	for _, tConfig := range telemetryConfigs(device) {
+		// 'buf' is an io.Writter to capture the template execution output for each device
+		buf := new(bytes.Buffer)
+		err = t.Execute(buf, tConfig)
+		if err != nil {
+			log.Printf("Could not execute telemetry config %v for router: %v", tConfig.SensorGroupID, err)
+			return nil, err
+		}
+		configs = append(configs, buf.String())
+	}
+	return configs, nil
+}
+
+// Seconds allowed to connect to a device and to each call on the connection
+const deviceTimeout = 15
+
+// connectDevice opens a gRPC connection to the device. The caller closes it.
+func connectDevice(device model.Device) (*grpc.ClientConn, error) {
+	return dialDevice(device, certPath(device.Name))
+}
+
+// dialDevice is connectDevice with the certificate read from certFile. The
+// dial context is dropped, calls on the connection use deviceCallContext.
+func dialDevice(device model.Device, certFile string) (*grpc.ClientConn, error) {
+	host := device.Ip + ":" + device.Port
+	conn, _, err := dialRouter(host, device.Username, device.Password, certFile, device.ClientCertificate, device.ClientKey, deviceTimeout)
+	if err != nil {
+		log.Printf("could not setup a client connection to %s, %v", host, err)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// deviceCallContext gives one call on a device connection its own deadline,
+// so a slow call does not eat into the time of the next ones
+func deviceCallContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), deviceTimeout * time.Second)
+}
+
+// devicePatch holds the fields of a partial update. Nil fields are kept.
+type devicePatch struct {
+	Name        *string   `json:"name"`
+	Ip          *string   `json:"ip"`
+	Port        *string   `json:"port"`
+	Username    *string   `json:"username"`
+	Password    *string   `json:"password"`
+	Certificate *string   `json:"certificate"`
+	ClientCertificate *string `json:"clientCertificate"`
+	ClientKey   *string   `json:"clientKey"`
+	Tags        *[]string `json:"tags"`
+	Profile     *string   `json:"profile"`
+	SampleInterval *int   `json:"sampleInterval"`
+}
+
+func (p devicePatch) apply(device model.Device) model.Device {
+	if p.Name != nil {
+		device.Name = *p.Name
+	}
+	if p.Ip != nil {
+		device.Ip = *p.Ip
+	}
+	if p.Port != nil {
+		device.Port = *p.Port
+	}
+	if p.Username != nil {
+		device.Username = *p.Username
+	}
+	if p.Password != nil {
+		device.Password = *p.Password
+	}
+	if p.Certificate != nil {
+		device.Certificate = *p.Certificate
+	}
+	if p.ClientCertificate != nil {
+		device.ClientCertificate = *p.ClientCertificate
+	}
+	if p.ClientKey != nil {
+		device.ClientKey = *p.ClientKey
+	}
+	if p.Tags != nil {
+		device.Tags = *p.Tags
+	}
+	if p.Profile != nil {
+		device.Profile = *p.Profile
+	}
+	if p.SampleInterval != nil {
+		device.SampleInterval = *p.SampleInterval
+	}
+	return device
+}
+
+// updateDevice replaces the stored device called name and rewrites its
+// certificate. If the connection parameters changed, only the collectors of
+// this device are restarted, and the telemetry config is pushed again if the
+// sample interval changed. Collected telemetry is kept. Devices cannot be
+// renamed.
+func updateDevice(name string, device model.Device, telemetryChannel chan model.TelemetryWrapper, actor string) (err error) {
+	defer func() {
+		recordAudit(actor, auditDeviceUpdate, name, "", err)
+	}()
+
+	if device.Name == "" {
+		device.Name = name
+	}
+	if device.Name != name {
+		return newServiceError(errorInvalid, "Device %v cannot be renamed to %v", name, device.Name)
+	}
+	device, err = resolveProfile(device)
+	if err != nil {
+		return err
+	}
+	if err := validateDevice(device); err != nil {
+		return err
+	}
+
+	current, err := getDevice(name)
+	if err != nil {
+		return err
+	}
+	if err := checkNewCertificates(device, current); err != nil {
+		return err
+	}
+	// Secrets are write-only, an empty password keeps the current one, and
+	// so does an empty client key if there is still a client certificate
+	if device.Password == "" {
+		device.Password = current.Password
+	}
+	if device.ClientKey == "" && device.ClientCertificate != "" {
+		device.ClientKey = current.ClientKey
+		if err := validateClientKeyPair(device); err != nil {
+			return err
+		}
+	}
+	device = describeCertificates(device)
+	// Managed by the inventory sync
+	device.Source = current.Source
+	device.DecommissionPending = current.DecommissionPending
+	// Pushed when the device was onboarded
+	device.Telemetry = current.Telemetry
+
+	session, dbCollection, err := openDevicesCollection()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	// The new IP cannot belong to another device
+	count, err := dbCollection.Find(bson.M{"ip": device.Ip, "name": bson.M{"$ne": name}}).Count()
+	if err != nil {
+		return fmt.Errorf("cannot read devices table: %v", err)
+	}
+	if (count > 0) {
+		return newServiceError(errorConflict, "IP %v already in use", device.Ip)
+	}
+
+	stored, err := sealDevice(device)
+	if err != nil {
+		return err
+	}
+	err = dbCollection.Update(bson.M{"name": name}, &stored)
+	if err == mgo.ErrNotFound {
+		return newServiceError(errorNotFound, "Device %v not found", name)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot update device table: %v", err)
+	}
+
+	if err = writeCertificate(device); err != nil {
+		return err
+	}
+
+	if credentialsChanged(current, device) {
+		recordAudit(actor, auditDeviceCredentials, name, "", nil)
+	}
+
+	if deviceSampleInterval(current) != deviceSampleInterval(device) {
+		err = configureTelemetry(device, actor)
+		if err != nil {
+			return fmt.Errorf("device saved but telemetry could not be reconfigured: %v", err)
+		}
+	}
+	if connectionChanged(current, device) {
+		collectors.start(device, telemetryChannel)
+	}
+	return nil
+}
+
+// connectionChanged tells if the collectors of the device need a restart
+func connectionChanged(current model.Device, updated model.Device) bool {
+	return current.Ip != updated.Ip ||
+		current.Port != updated.Port ||
+		current.Username != updated.Username ||
+		current.Password != updated.Password ||
+		current.Certificate != updated.Certificate ||
+		current.ClientCertificate != updated.ClientCertificate ||
+		current.ClientKey != updated.ClientKey ||
+		deviceSampleInterval(current) != deviceSampleInterval(updated)
+}
+
+// credentialsChanged tells if the credentials of the device changed, which is
+// audited on its own
+func credentialsChanged(current model.Device, updated model.Device) bool {
+	return current.Username != updated.Username ||
+		current.Password != updated.Password ||
+		current.Certificate != updated.Certificate ||
+		current.ClientCertificate != updated.ClientCertificate ||
+		current.ClientKey != updated.ClientKey ||
+		current.Profile != updated.Profile
+}
+
+// decommissionStep is the outcome of one step of a device decommission
+type decommissionStep struct {
+	Step  string `json:"step"`
+	Error string `json:"error,omitempty"`
+}
+
+// deleteDevice decommissions the device: its collectors are stopped, the
+// tviewer telemetry configuration is removed from the router and its
+// certificate, stored telemetry and device row are deleted. Every step is
+// attempted even if an earlier one fails, so a device that cannot be reached
+// is still removed from tviewer. Failures are reported as a partial failure
+// with the outcome of each step.
+func deleteDevice(name string, telemetryChannel chan model.TelemetryWrapper, actor string) (err error) {
+	defer func() {
+		recordAudit(actor, auditDeviceDelete, name, "", err)
+	}()
+
+	device, err := getDevice(name)
+	if err != nil {
+		return err
+	}
+
+	var steps []decommissionStep
+	failed := 0
+	run := func(step string, f func() error) {
+		result := decommissionStep{Step: step}
+		if err := f(); err != nil {
+			log.Printf("Cannot %v for device %v: %v", step, name, err)
+			result.Error = err.Error()
+			failed++
+		}
+		steps = append(steps, result)
+	}
+
+	run("stop collectors", func() error {
+		collectors.stop(name)
+		return nil
+	})
+	run("remove router telemetry config", func() error {
+		return removeTelemetry(device, actor)
+	})
+	run("remove certificate", func() error {
+		err := os.Remove(certPath(name))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	})
+	run("remove stored telemetry", func() error {
+		return removeStoredTelemetry(name)
+	})
+	run("remove device", func() error {
+		session, dbCollection, err := openDevicesCollection()
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+
+		err = dbCollection.Remove(bson.M{"name": name})
+		if err != nil && err != mgo.ErrNotFound {
+			return fmt.Errorf("cannot delete data in device table: %v", err)
+		}
+		return nil
+	})
+
+	// Trigger update to the clients, the node is gone from the topology
+	telemetryChannel <- model.TelemetryWrapper{}
+
+	if failed > 0 {
+		return &serviceError{
+			kind:    errorPartial,
+			message: fmt.Sprintf("Device %v decommissioned with %v failed step(s)", name, failed),
+			details: steps,
+		}
+	}
+	return nil
+}
+
+// removeStoredTelemetry deletes the interface and ISIS rows of the node
+func removeStoredTelemetry(nodeName string) error {
+	session, err := mgo.Dial(currentConfig().Database)
+	if err != nil {
+		return fmt.Errorf("cannot open database: %v", err)
+	}
+	defer session.Close()
+
+	for _, collection := range []string{"Interfaces", "ISIS"} {
+		_, err = session.DB(currentConfig().DatabaseName).C(collection).RemoveAll(bson.M{"nodename": nodeName})
+		if err != nil {
+			return fmt.Errorf("cannot delete data in %v table: %v", collection, err)
+		}
+	}
+	return nil
+}
+
+func certPath(deviceName string) string {
+	return currentConfig().BasePath + "/certs/" + deviceName + ".pem"
+}
@@ -0,0 +1,224 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	xr "github.com/nleiva/xrgrpc"
+	"github.com/sfloresk/tviewer/model"
+)
+
+// Dry run check that reads the router configuration, after stepValidate and
+// stepConnect
+const checkConfigRead = "current_config_read"
+
+// Request ID used to read the current telemetry configuration
+const getConfigRequestID int64 = 1200
+
+// Filter for GetConfig that returns the whole telemetry configuration
+const telemetryConfigFilter = `{"openconfig-telemetry:telemetry-system": [null]}`
+
+// Keys of the lists in the openconfig telemetry model, used to match the
+// entries of a list the way the router does when merging
+var telemetryListKeys = []string{"sensor-group-id", "subscription-id", "sensor-group", "path"}
+
+// sensorGroupPreview is what onboarding would push for one sensor group
+type sensorGroupPreview struct {
+	SensorGroupID  string           `json:"sensorGroupId"`
+	SubscriptionID string           `json:"subscriptionId"`
+	Config         interface{}      `json:"config"`
+	Changes        []patchOperation `json:"changes"`
+}
+
+// dryRunResult is the outcome of an onboarding dry run. Changes are RFC 6902
+// operations on the current telemetry configuration of the router.
+type dryRunResult struct {
+	Device       string               `json:"device"`
+	OK           bool                 `json:"ok"`
+	Checks       []jobStep            `json:"checks"`
+	Current      interface{}          `json:"current,omitempty"`
+	SensorGroups []sensorGroupPreview `json:"sensorGroups"`
+}
+
+func (d *dryRunResult) check(name string, err error) bool {
+	step := jobStep{Name: name, Status: stepDone}
+	if err != nil {
+		step.Status = stepFailed
+		step.Error = err.Error()
+		d.OK = false
+	}
+	d.Checks = append(d.Checks, step)
+	return err == nil
+}
+
+// dryRunOnboarding renders the telemetry config of every sensor group and
+// checks connectivity and credentials by reading the current telemetry
+// config. Nothing is stored or pushed. Invalid devices are returned as
+// errors; failed checks are reported in the result.
+func dryRunOnboarding(device model.Device) (dryRunResult, error) {
+	result := dryRunResult{Device: device.Name, OK: true}
+
+	// Nothing is pushed, so nothing is audited
+	o := newOnboarding(device, "")
+	if err := o.validate(); err != nil {
+		return result, err
+	}
+	if jobs.onboarding(o.device.Name, o.device.Ip) {
+		return result, newServiceError(errorConflict, "Device %v or IP %v is already being onboarded", o.device.Name, o.device.Ip)
+	}
+	result.check(stepValidate, nil)
+
+	configs, err := renderTelemetryConfigs(o.device)
+	if err != nil {
+		return result, err
+	}
+	tConfigs := telemetryConfigs(o.device)
+	for i, config := range configs {
+		var document interface{}
+		if err := json.Unmarshal([]byte(config), &document); err != nil {
+			return result, fmt.Errorf("rendered telemetry config for %v is not valid JSON: %v", tConfigs[i].SensorGroupID, err)
+		}
+		result.SensorGroups = append(result.SensorGroups, sensorGroupPreview{
+			SensorGroupID:  tConfigs[i].SensorGroupID,
+			SubscriptionID: tConfigs[i].SubscriptionID,
+			Config:         document,
+		})
+	}
+
+	// The device is not stored yet, so its certificate goes to a temporary file
+	certFile, err := ioutil.TempFile("", "tviewer-cert")
+	if err != nil {
+		return result, fmt.Errorf("cannot create cert file: %v", err)
+	}
+	defer os.Remove(certFile.Name())
+	_, err = certFile.WriteString(o.device.Certificate)
+	certFile.Close()
+	if err != nil {
+		return result, fmt.Errorf("cannot create cert file: %v", err)
+	}
+
+	conn, err := dialDevice(o.device, certFile.Name())
+	if !result.check(stepConnect, err) {
+		return result, nil
+	}
+	defer conn.Close()
+
+	ctx, cancel := deviceCallContext()
+	defer cancel()
+
+	// First RPC on the connection, so this also checks the credentials
+	var current interface{}
+	raw, err := xr.GetConfig(ctx, conn, telemetryConfigFilter, getConfigRequestID)
+	if err == nil {
+		current, err = parseDeviceConfig(raw)
+	}
+	if !result.check(checkConfigRead, err) {
+		return result, nil
+	}
+	result.Current = current
+
+	// Each sensor group is merged on top of the previous ones, as onboarding does
+	for i := range result.SensorGroups {
+		document, _ := toJSONDocument(current)
+		merged := mergeConfigDocument(document, result.SensorGroups[i].Config)
+		result.SensorGroups[i].Changes = diffJSON(current, merged)
+		current = merged
+	}
+	return result, nil
+}
+
+// parseDeviceConfig decodes the JSON returned by GetConfig, without the data
+// wrapper the router adds. No configuration comes back as an empty string.
+func parseDeviceConfig(raw string) (interface{}, error) {
+	if raw == "" {
+		return map[string]interface{}{}, nil
+	}
+	var document interface{}
+	if err := json.Unmarshal([]byte(raw), &document); err != nil {
+		return nil, fmt.Errorf("cannot decode the current config: %v", err)
+	}
+	if wrapper, ok := document.(map[string]interface{}); ok {
+		if data, ok := wrapper["data"]; ok && len(wrapper) == 1 {
+			return data, nil
+		}
+	}
+	return document, nil
+}
+
+// mergeConfigDocument returns current with config merged on top: objects are
+// merged field by field and list entries with the same key are merged
+// instead of appended. Nothing is removed, as with MergeConfig. current is
+// modified.
+func mergeConfigDocument(current, config interface{}) interface{} {
+	switch configValue := config.(type) {
+	case map[string]interface{}:
+		currentValue, ok := current.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for key, configChild := range configValue {
+			if currentChild, ok := currentValue[key]; ok {
+				currentValue[key] = mergeConfigDocument(currentChild, configChild)
+			} else {
+				currentValue[key] = configChild
+			}
+		}
+		return currentValue
+	case []interface{}:
+		currentValue, ok := current.([]interface{})
+		if !ok {
+			break
+		}
+		for _, configItem := range configValue {
+			merged := false
+			for i, currentItem := range currentValue {
+				if sameListEntry(currentItem, configItem) {
+					currentValue[i] = mergeConfigDocument(currentItem, configItem)
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				currentValue = append(currentValue, configItem)
+			}
+		}
+		return currentValue
+	}
+	return config
+}
+
+// sameListEntry tells if two list entries have the same key
+func sameListEntry(a, b interface{}) bool {
+	aValue, ok := a.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	bValue, ok := b.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for _, key := range telemetryListKeys {
+		if bKey, ok := bValue[key]; ok {
+			return aValue[key] == bKey
+		}
+	}
+	return false
+}
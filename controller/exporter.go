@@ -0,0 +1,271 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"sync"
+	"time"
+	"github.com/prometheus/client_golang/prometheus"
+	ifcs "github.com/sfloresk/tviewer/proto/telemetry/interface"
+	isis "github.com/sfloresk/tviewer/proto/telemetry/isis"
+)
+
+// State of an ISIS adjacency that is up, as sent by IOS XR
+const isisAdjacencyUp = "isis-adj-up-state"
+
+var (
+	interfaceLabels = []string{"node", "interface"}
+	adjacencyLabels = []string{"node", "interface", "neighbour"}
+
+	descInterfaceUp                 = prometheus.NewDesc("tviewer_interface_up", "1 when the interface is up, 0 otherwise.", interfaceLabels, nil)
+	descInterfaceReceivePackets     = prometheus.NewDesc("tviewer_interface_receive_packets_total", "Packets received on the interface.", interfaceLabels, nil)
+	descInterfaceReceiveBytes       = prometheus.NewDesc("tviewer_interface_receive_bytes_total", "Bytes received on the interface.", interfaceLabels, nil)
+	descInterfaceTransmitPackets    = prometheus.NewDesc("tviewer_interface_transmit_packets_total", "Packets sent on the interface.", interfaceLabels, nil)
+	descInterfaceTransmitBytes      = prometheus.NewDesc("tviewer_interface_transmit_bytes_total", "Bytes sent on the interface.", interfaceLabels, nil)
+	descInterfaceReceivePacketRate  = prometheus.NewDesc("tviewer_interface_receive_packets_per_second", "Packets received per second between the last two samples.", interfaceLabels, nil)
+	descInterfaceReceiveByteRate    = prometheus.NewDesc("tviewer_interface_receive_bytes_per_second", "Bytes received per second between the last two samples.", interfaceLabels, nil)
+	descInterfaceTransmitPacketRate = prometheus.NewDesc("tviewer_interface_transmit_packets_per_second", "Packets sent per second between the last two samples.", interfaceLabels, nil)
+	descInterfaceTransmitByteRate   = prometheus.NewDesc("tviewer_interface_transmit_bytes_per_second", "Bytes sent per second between the last two samples.", interfaceLabels, nil)
+
+	descAdjacencyUp       = prometheus.NewDesc("tviewer_isis_adjacency_up", "1 when the ISIS adjacency is up, 0 otherwise.", adjacencyLabels, nil)
+	descAdjacencyState    = prometheus.NewDesc("tviewer_isis_adjacency_state", "State of the ISIS adjacency, always 1.", append(adjacencyLabels, "state"), nil)
+	descAdjacencyUptime   = prometheus.NewDesc("tviewer_isis_adjacency_uptime_seconds", "Time the ISIS adjacency has been up.", adjacencyLabels, nil)
+	descAdjacencyHoldtime = prometheus.NewDesc("tviewer_isis_adjacency_holdtime_seconds", "Remaining hold time of the ISIS adjacency.", adjacencyLabels, nil)
+	descAdjacencies       = prometheus.NewDesc("tviewer_isis_adjacencies", "ISIS adjacencies of the node.", []string{"node"}, nil)
+	descAdjacenciesUp     = prometheus.NewDesc("tviewer_isis_adjacencies_up", "ISIS adjacencies of the node that are up.", []string{"node"}, nil)
+)
+
+// interfaceSample is the last interface telemetry received for an interface
+type interfaceSample struct {
+	name            string
+	time            time.Time
+	up              bool
+	receivePackets  uint64
+	receiveBytes    uint64
+	transmitPackets uint64
+	transmitBytes   uint64
+
+	// Per second since the previous sample, unknown for the first one or
+	// after a counter reset
+	hasRates           bool
+	receivePacketRate  float64
+	receiveByteRate    float64
+	transmitPacketRate float64
+	transmitByteRate   float64
+}
+
+func newInterfaceSample(ts uint64, iface *ifcs.FibShInt) interfaceSample {
+	return interfaceSample{
+		name:            iface.GetPerInterface(),
+		time:            time.Unix(0, int64(ts)*int64(time.Millisecond)),
+		up:              iface.GetInterfaceUpFlag(),
+		receivePackets:  iface.GetNumberOfInputPackets(),
+		receiveBytes:    iface.GetNumberOfInputBytes(),
+		transmitPackets: iface.GetNumberOfOutputPackets(),
+		transmitBytes:   iface.GetNumberOfOutputBytes(),
+	}
+}
+
+// setRates computes the rates since the previous sample of the interface
+func (s *interfaceSample) setRates(previous interfaceSample) {
+	seconds := s.time.Sub(previous.time).Seconds()
+	if seconds <= 0 ||
+		s.receivePackets < previous.receivePackets || s.receiveBytes < previous.receiveBytes ||
+		s.transmitPackets < previous.transmitPackets || s.transmitBytes < previous.transmitBytes {
+		return
+	}
+	s.hasRates = true
+	s.receivePacketRate = float64(s.receivePackets-previous.receivePackets) / seconds
+	s.receiveByteRate = float64(s.receiveBytes-previous.receiveBytes) / seconds
+	s.transmitPacketRate = float64(s.transmitPackets-previous.transmitPackets) / seconds
+	s.transmitByteRate = float64(s.transmitBytes-previous.transmitBytes) / seconds
+}
+
+// adjacencySample is the last ISIS telemetry received for an adjacency
+type adjacencySample struct {
+	iface       string
+	neighbour   string
+	state       string
+	uptimeValid bool
+	uptime      uint32
+	holdtime    uint32
+}
+
+func newAdjacencySample(nbr *isis.IsisShNbr) adjacencySample {
+	return adjacencySample{
+		iface:       nbr.GetLocalInterface(),
+		neighbour:   nbr.GetNeighborSystemId(),
+		state:       nbr.GetNeighborState(),
+		uptimeValid: nbr.GetNeighborUptimeValidFlag(),
+		uptime:      nbr.GetNeighborUptime(),
+		holdtime:    nbr.GetNeighborHoldtime(),
+	}
+}
+
+// nodeInterfaces and nodeAdjacencies are the samples of a node with the
+// generation of the collector that stored them, see Node.Generation
+type nodeInterfaces struct {
+	generation uint64
+	samples    map[string]interfaceSample
+}
+
+type nodeAdjacencies struct {
+	generation uint64
+	samples    []adjacencySample
+}
+
+// networkCollector exports the latest interface and ISIS telemetry of every
+// device. Each message replaces what the node had before, so interfaces and
+// adjacencies that go away stop being exported. Samples of an older
+// generation than the stored ones are dropped, so a collector that is being
+// replaced cannot overwrite or remove the series of the new one.
+type networkCollector struct {
+	mu          sync.Mutex
+	interfaces  map[string]nodeInterfaces
+	adjacencies map[string]nodeAdjacencies
+}
+
+var networkMetrics = &networkCollector{
+	interfaces:  make(map[string]nodeInterfaces),
+	adjacencies: make(map[string]nodeAdjacencies),
+}
+
+// networkRegistry holds the network metrics apart from the default registry,
+// so they are only served to logged in users, see health.registerRoutes
+var networkRegistry = prometheus.NewRegistry()
+
+func init() {
+	networkRegistry.MustRegister(networkMetrics)
+}
+
+// setInterfaces stores the interfaces of a telemetry message of the node
+func (n *networkCollector) setInterfaces(node string, generation uint64, samples []interfaceSample) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	previous := n.interfaces[node]
+	if previous.generation > generation {
+		return
+	}
+	current := make(map[string]interfaceSample)
+	for _, sample := range samples {
+		// The router counters go on across collector restarts
+		if last, ok := previous.samples[sample.name]; ok {
+			sample.setRates(last)
+		}
+		current[sample.name] = sample
+	}
+	n.interfaces[node] = nodeInterfaces{generation: generation, samples: current}
+}
+
+// setAdjacencies stores the adjacencies of a telemetry message of the node
+func (n *networkCollector) setAdjacencies(node string, generation uint64, samples []adjacencySample) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.adjacencies[node].generation > generation {
+		return
+	}
+	n.adjacencies[node] = nodeAdjacencies{generation: generation, samples: samples}
+}
+
+// removeInterfaces and removeAdjacencies stop exporting the node once its
+// collectors stop, so its data does not go stale. Series stored by a newer
+// generation are kept.
+func (n *networkCollector) removeInterfaces(node string, generation uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.interfaces[node].generation == generation {
+		delete(n.interfaces, node)
+	}
+}
+
+func (n *networkCollector) removeAdjacencies(node string, generation uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.adjacencies[node].generation == generation {
+		delete(n.adjacencies, node)
+	}
+}
+
+func (n *networkCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		descInterfaceUp, descInterfaceReceivePackets, descInterfaceReceiveBytes,
+		descInterfaceTransmitPackets, descInterfaceTransmitBytes,
+		descInterfaceReceivePacketRate, descInterfaceReceiveByteRate,
+		descInterfaceTransmitPacketRate, descInterfaceTransmitByteRate,
+		descAdjacencyUp, descAdjacencyState, descAdjacencyUptime, descAdjacencyHoldtime,
+		descAdjacencies, descAdjacenciesUp,
+	} {
+		ch <- desc
+	}
+}
+
+func (n *networkCollector) Collect(ch chan<- prometheus.Metric) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for node, interfaces := range n.interfaces {
+		for name, sample := range interfaces.samples {
+			ch <- prometheus.MustNewConstMetric(descInterfaceUp, prometheus.GaugeValue, boolValue(sample.up), node, name)
+			ch <- prometheus.MustNewConstMetric(descInterfaceReceivePackets, prometheus.CounterValue, float64(sample.receivePackets), node, name)
+			ch <- prometheus.MustNewConstMetric(descInterfaceReceiveBytes, prometheus.CounterValue, float64(sample.receiveBytes), node, name)
+			ch <- prometheus.MustNewConstMetric(descInterfaceTransmitPackets, prometheus.CounterValue, float64(sample.transmitPackets), node, name)
+			ch <- prometheus.MustNewConstMetric(descInterfaceTransmitBytes, prometheus.CounterValue, float64(sample.transmitBytes), node, name)
+			if sample.hasRates {
+				ch <- prometheus.MustNewConstMetric(descInterfaceReceivePacketRate, prometheus.GaugeValue, sample.receivePacketRate, node, name)
+				ch <- prometheus.MustNewConstMetric(descInterfaceReceiveByteRate, prometheus.GaugeValue, sample.receiveByteRate, node, name)
+				ch <- prometheus.MustNewConstMetric(descInterfaceTransmitPacketRate, prometheus.GaugeValue, sample.transmitPacketRate, node, name)
+				ch <- prometheus.MustNewConstMetric(descInterfaceTransmitByteRate, prometheus.GaugeValue, sample.transmitByteRate, node, name)
+			}
+		}
+	}
+
+	for node, adjacencies := range n.adjacencies {
+		up := 0
+		// Telemetry rows are unique per interface and neighbour, but the
+		// registry rejects duplicate series, so skip any repeat
+		seen := make(map[[2]string]bool)
+		for _, sample := range adjacencies.samples {
+			key := [2]string{sample.iface, sample.neighbour}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			isUp := sample.state == isisAdjacencyUp
+			if isUp {
+				up++
+			}
+			ch <- prometheus.MustNewConstMetric(descAdjacencyUp, prometheus.GaugeValue, boolValue(isUp), node, sample.iface, sample.neighbour)
+			ch <- prometheus.MustNewConstMetric(descAdjacencyState, prometheus.GaugeValue, 1, node, sample.iface, sample.neighbour, sample.state)
+			if sample.uptimeValid {
+				ch <- prometheus.MustNewConstMetric(descAdjacencyUptime, prometheus.GaugeValue, float64(sample.uptime), node, sample.iface, sample.neighbour)
+			}
+			ch <- prometheus.MustNewConstMetric(descAdjacencyHoldtime, prometheus.GaugeValue, float64(sample.holdtime), node, sample.iface, sample.neighbour)
+		}
+		ch <- prometheus.MustNewConstMetric(descAdjacencies, prometheus.GaugeValue, float64(len(seen)), node)
+		ch <- prometheus.MustNewConstMetric(descAdjacenciesUp, prometheus.GaugeValue, float64(up), node)
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
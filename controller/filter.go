@@ -0,0 +1,184 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"github.com/sfloresk/tviewer/model"
+)
+
+// Overlay layers that can be selected in a filter. Interfaces are always sent,
+// since the other layers hang from them.
+const (
+	layerISIS        = "isis"
+	layerUtilization = "utilization"
+)
+
+var topologyLayers = []string{layerISIS, layerUtilization}
+
+// Layers that tviewer has no telemetry for, with the reason. They are
+// rejected with it instead of as unknown layers.
+var unsupportedLayers = map[string]string{
+	"bgp": "no BGP sensor group is configured on the devices",
+}
+
+// topologyFilter selects the part of the topology a client is interested in.
+// Every non-empty criterion must match; within a criterion any value matches.
+type topologyFilter struct {
+	// Node name patterns, as accepted by path.Match (e.g. "pe-*")
+	Nodes  []string `json:"nodes"`
+	// Device tags, the node must have at least one of them
+	Tags   []string `json:"tags"`
+	// ISIS area addresses (e.g. "49.0001")
+	Areas  []string `json:"areas"`
+	// Overlay layers to include. Empty means all of them
+	Layers []string `json:"layers"`
+}
+
+// filterFromQuery reads a filter from the nodes, tags, areas and layers query
+// parameters. Each one can be repeated or hold a comma separated list.
+// It returns nil if none of them is present.
+func filterFromQuery(query url.Values) (*topologyFilter, error) {
+	filter := &topologyFilter{
+		Nodes:  queryList(query, "nodes"),
+		Tags:   queryList(query, "tags"),
+		Areas:  queryList(query, "areas"),
+		Layers: queryList(query, "layers"),
+	}
+	if filter.isEmpty() {
+		return nil, nil
+	}
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+func queryList(query url.Values, key string) []string {
+	result := make([]string, 0)
+	for _, value := range query[key] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				result = append(result, item)
+			}
+		}
+	}
+	return result
+}
+
+func (f *topologyFilter) validate() error {
+	for _, pattern := range f.Nodes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid node pattern %q: %v", pattern, err)
+		}
+	}
+	for _, layer := range f.Layers {
+		if reason, ok := unsupportedLayers[layer]; ok {
+			return fmt.Errorf("layer %q is not supported: %v", layer, reason)
+		}
+		if !containsString(topologyLayers, layer) {
+			return fmt.Errorf("unknown layer %q, supported layers are %v", layer, topologyLayers)
+		}
+	}
+	return nil
+}
+
+// isEmpty tells if the filter lets the whole topology through
+func (f *topologyFilter) isEmpty() bool {
+	return len(f.Nodes) == 0 && len(f.Tags) == 0 && len(f.Areas) == 0 && len(f.Layers) == 0
+}
+
+// apply returns the matching nodes. The input is not modified.
+func (f *topologyFilter) apply(nodes []model.Node) []model.Node {
+	result := make([]model.Node, 0)
+	for _, node := range nodes {
+		if !f.matches(node) {
+			continue
+		}
+		if len(f.Layers) > 0 {
+			node = f.withLayers(node)
+		}
+		result = append(result, node)
+	}
+	return result
+}
+
+func (f *topologyFilter) matches(node model.Node) bool {
+	if len(f.Nodes) > 0 {
+		matched := false
+		for _, pattern := range f.Nodes {
+			if ok, _ := path.Match(pattern, node.Name); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(f.Tags) > 0 && !containsAny(node.Tags, f.Tags) {
+		return false
+	}
+	if len(f.Areas) > 0 && !containsAny(node.Areas, f.Areas) {
+		return false
+	}
+	return true
+}
+
+// withLayers copies the node without the layers the filter leaves out
+func (f *topologyFilter) withLayers(node model.Node) model.Node {
+	isis := containsString(f.Layers, layerISIS)
+	utilization := containsString(f.Layers, layerUtilization)
+
+	interfaces := make([]model.Interface, len(node.Interfaces))
+	for i, iface := range node.Interfaces {
+		if !isis {
+			iface.IsisNeighbours = make([]model.IsisNeighbor, 0)
+		}
+		if !utilization {
+			iface.Utilization = nil
+		}
+		interfaces[i] = iface
+	}
+	node.Interfaces = interfaces
+	if !isis {
+		node.Areas = make([]string, 0)
+	}
+	return node
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(list []string, values []string) bool {
+	for _, value := range values {
+		if containsString(list, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,407 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"github.com/sfloresk/tviewer/model"
+	pb "github.com/sfloresk/tviewer/proto/tviewer"
+	"google.golang.org/grpc"
+	grpccredentials "google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer implements the Tviewer gRPC service on top of the same hub and
+// device operations used by the web API
+type grpcServer struct {
+	hub              *hub
+	telemetryChannel chan model.TelemetryWrapper
+}
+
+// gRPC API server, stopped by Shutdown
+var grpcAPIServer *grpc.Server
+var grpcAPIServerMutex sync.Mutex
+
+// ServeGRPC serves the gRPC API on address until it fails, or returns nil
+// after Shutdown. It must be called after Startup.
+func ServeGRPC(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	options := []grpc.ServerOption{
+		grpc.UnaryInterceptor(grpcAuthUnary),
+		grpc.StreamInterceptor(grpcAuthStream),
+	}
+	// Same certificate as the web server
+	if serverTLSConfig != nil {
+		options = append(options, grpc.Creds(grpccredentials.NewTLS(serverTLSConfig)))
+	}
+	server := grpc.NewServer(options...)
+	grpcAPIServerMutex.Lock()
+	grpcAPIServer = server
+	grpcAPIServerMutex.Unlock()
+	pb.RegisterTviewerServer(server, &grpcServer{
+		hub:              topologyController.hub,
+		telemetryChannel: devicesController.telemetryChannel,
+	})
+	return server.Serve(listener)
+}
+
+// Role required by each method, those not listed need an admin
+var grpcMethodRoles = map[string]string{
+	"/tviewer.Tviewer/GetTopology":   roleViewer,
+	"/tviewer.Tviewer/WatchTopology": roleViewer,
+	"/tviewer.Tviewer/ListDevices":   roleOperator,
+	"/tviewer.Tviewer/GetDevice":     roleOperator,
+}
+
+// grpcAuthorize checks the role of the user in the context for the method
+func grpcAuthorize(ctx context.Context, method string) error {
+	role, ok := grpcMethodRoles[method]
+	if !ok {
+		role = roleAdmin
+	}
+	user, _ := ctx.Value(userContextKey).(model.User)
+	if !allowed(user, role, "gRPC " + method) {
+		return status.Error(codes.PermissionDenied, "Role " + role + " required")
+	}
+	return nil
+}
+
+// grpcAuthenticate checks the API token sent as "authorization: Bearer <token>"
+// metadata and adds its user to the context
+func grpcAuthenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, header := range md.Get("authorization") {
+		if !strings.HasPrefix(header, "Bearer ") {
+			continue
+		}
+		if user, ok := userForToken(strings.TrimPrefix(header, "Bearer ")); ok {
+			return context.WithValue(ctx, userContextKey, user), nil
+		}
+	}
+	return nil, status.Error(codes.Unauthenticated, "A valid API token is required")
+}
+
+// grpcUser returns the name of the user authenticated for the call
+func grpcUser(ctx context.Context) string {
+	user, _ := ctx.Value(userContextKey).(model.User)
+	return user.Name
+}
+
+func grpcAuthUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := grpcAuthenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = grpcAuthorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authStream overrides the context of the stream with the authenticated one
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authStream) Context() context.Context {
+	return s.ctx
+}
+
+func grpcAuthStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := grpcAuthenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	if err = grpcAuthorize(ctx, info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, authStream{ServerStream: stream, ctx: ctx})
+}
+
+func (s *grpcServer) GetTopology(ctx context.Context, req *pb.GetTopologyRequest) (*pb.Topology, error) {
+	filter, err := filterFromProto(req.GetFilter())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	version, nodes := s.hub.snapshot()
+	if filter != nil {
+		nodes = filter.apply(nodes)
+	}
+	return topologyToProto(version, nodes), nil
+}
+
+func (s *grpcServer) WatchTopology(req *pb.WatchTopologyRequest, stream pb.Tviewer_WatchTopologyServer) error {
+	filter, err := filterFromProto(req.GetFilter())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	addr := "unknown"
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		addr = p.Addr.String()
+	}
+	client := newHubClient(addr, req.GetFullSnapshots())
+	client.filter = filter
+	client.lastID = req.GetResumeFrom()
+
+	s.hub.register <- client
+	defer func() {
+		s.hub.unregister <- client
+	}()
+
+	for {
+		select {
+		case message, ok := <-client.send:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "Client evicted for not keeping up with topology changes")
+			}
+			event, err := eventFromMessage(message, client.fullSnapshots)
+			if err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+			if err = stream.Send(event); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-shuttingDown:
+			return status.Error(codes.Unavailable, "tviewer is shutting down")
+		}
+	}
+}
+
+func (s *grpcServer) ListDevices(ctx context.Context, req *pb.ListDevicesRequest) (*pb.ListDevicesResponse, error) {
+	devices, err := listDevices()
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	response := &pb.ListDevicesResponse{}
+	for _, device := range devices {
+		response.Devices = append(response.Devices, deviceToProto(device))
+	}
+	return response, nil
+}
+
+func (s *grpcServer) GetDevice(ctx context.Context, req *pb.GetDeviceRequest) (*pb.Device, error) {
+	device, err := getDevice(req.GetName())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return deviceToProto(device), nil
+}
+
+func (s *grpcServer) CreateDevice(ctx context.Context, req *pb.CreateDeviceRequest) (*pb.Device, error) {
+	if req.GetDevice() == nil {
+		return nil, status.Error(codes.InvalidArgument, "Device is required")
+	}
+	device := deviceFromProto(req.GetDevice())
+	device, err := addDevice(device, s.telemetryChannel, grpcUser(ctx))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return deviceToProto(device), nil
+}
+
+func (s *grpcServer) UpdateDevice(ctx context.Context, req *pb.UpdateDeviceRequest) (*pb.Device, error) {
+	if req.GetDevice() == nil {
+		return nil, status.Error(codes.InvalidArgument, "Device is required")
+	}
+	device := deviceFromProto(req.GetDevice())
+	if err := updateDevice(device.Name, device, s.telemetryChannel, grpcUser(ctx)); err != nil {
+		return nil, grpcError(err)
+	}
+	device, err := getDevice(device.Name)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return deviceToProto(device), nil
+}
+
+func (s *grpcServer) DeleteDevice(ctx context.Context, req *pb.DeleteDeviceRequest) (*pb.DeleteDeviceResponse, error) {
+	if err := deleteDevice(req.GetName(), s.telemetryChannel, grpcUser(ctx)); err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.DeleteDeviceResponse{}, nil
+}
+
+func grpcError(err error) error {
+	switch kindOf(err) {
+	case errorInvalid:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errorNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case errorConflict:
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errorPartial:
+		if steps, ok := err.(*serviceError).details.([]decommissionStep); ok {
+			message := err.Error()
+			for _, step := range steps {
+				if step.Error != "" {
+					message += "; " + step.Step + ": " + step.Error
+				}
+			}
+			return status.Error(codes.Internal, message)
+		}
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// eventFromMessage converts a message queued by the hub for a websocket
+// client into its gRPC form
+func eventFromMessage(message hubMessage, fullSnapshots bool) (*pb.TopologyEvent, error) {
+	var epoch int64
+	var version uint64
+	fmt.Sscanf(message.ID, "%d-%d", &epoch, &version)
+
+	event := &pb.TopologyEvent{Id: message.ID}
+	switch {
+	case message.Type == messageSnapshot && fullSnapshots:
+		var nodes []model.Node
+		if err := json.Unmarshal(message.Data, &nodes); err != nil {
+			return nil, err
+		}
+		event.Event = &pb.TopologyEvent_Snapshot{Snapshot: topologyToProto(version, nodes)}
+	case message.Type == messageSnapshot:
+		var snapshot snapshotMessage
+		if err := json.Unmarshal(message.Data, &snapshot); err != nil {
+			return nil, err
+		}
+		event.Event = &pb.TopologyEvent_Snapshot{Snapshot: topologyToProto(snapshot.Version, snapshot.Data)}
+	case message.Type == messagePatch:
+		var patch struct {
+			Version     uint64          `json:"version"`
+			BaseVersion uint64          `json:"baseVersion"`
+			Ops         json.RawMessage `json:"ops"`
+		}
+		if err := json.Unmarshal(message.Data, &patch); err != nil {
+			return nil, err
+		}
+		event.Event = &pb.TopologyEvent_Patch{Patch: &pb.TopologyPatch{
+			Version:     patch.Version,
+			BaseVersion: patch.BaseVersion,
+			JsonPatch:   string(patch.Ops),
+		}}
+	default:
+		return nil, fmt.Errorf("unexpected topology message %v", message.Type)
+	}
+	return event, nil
+}
+
+func filterFromProto(filter *pb.TopologyFilter) (*topologyFilter, error) {
+	if filter == nil {
+		return nil, nil
+	}
+	result := &topologyFilter{
+		Nodes:  filter.GetNodes(),
+		Tags:   filter.GetTags(),
+		Areas:  filter.GetAreas(),
+		Layers: filter.GetLayers(),
+	}
+	if result.isEmpty() {
+		return nil, nil
+	}
+	if err := result.validate(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func topologyToProto(version uint64, nodes []model.Node) *pb.Topology {
+	topology := &pb.Topology{Version: version}
+	for _, node := range nodes {
+		pbNode := &pb.Node{
+			Name:       node.Name,
+			Tags:       node.Tags,
+			Areas:      node.Areas,
+			Annotation: node.Annotation,
+		}
+		for _, iface := range node.Interfaces {
+			pbInterface := &pb.Interface{
+				Name: iface.Name,
+				Ipv4: iface.IPv4,
+			}
+			for _, neighbour := range iface.IsisNeighbours {
+				pbInterface.IsisNeighbours = append(pbInterface.IsisNeighbours, &pb.IsisNeighbor{
+					Ipv4:  neighbour.IPv4,
+					Areas: neighbour.Areas,
+				})
+			}
+			if iface.Utilization != nil {
+				pbInterface.Utilization = &pb.Utilization{
+					ReceiveBps:  iface.Utilization.ReceiveBps,
+					TransmitBps: iface.Utilization.TransmitBps,
+					ReceivePps:  iface.Utilization.ReceivePps,
+					TransmitPps: iface.Utilization.TransmitPps,
+				}
+			}
+			pbNode.Interfaces = append(pbNode.Interfaces, pbInterface)
+		}
+		topology.Nodes = append(topology.Nodes, pbNode)
+	}
+	return topology
+}
+
+// deviceToProto leaves out the password and the client key, which are
+// write-only
+func deviceToProto(device model.Device) *pb.Device {
+	pbDevice := &pb.Device{
+		Name:                device.Name,
+		Ip:                  device.Ip,
+		Port:                device.Port,
+		Username:            device.Username,
+		Certificate:         device.Certificate,
+		Tags:                device.Tags,
+		SampleInterval:      int32(device.SampleInterval),
+		Profile:             device.Profile,
+		ClientCertificate:   device.ClientCertificate,
+		CertificateExpiring: certificateExpiring(device),
+	}
+	if device.CertificateExpiry != nil {
+		pbDevice.CertificateExpiry = device.CertificateExpiry.Format(time.RFC3339)
+	}
+	return pbDevice
+}
+
+func deviceFromProto(device *pb.Device) model.Device {
+	return model.Device{
+		Name:              device.GetName(),
+		Ip:                device.GetIp(),
+		Port:              device.GetPort(),
+		Username:          device.GetUsername(),
+		Password:          device.GetPassword(),
+		Certificate:       device.GetCertificate(),
+		Tags:              device.GetTags(),
+		SampleInterval:    int(device.GetSampleInterval()),
+		Profile:           device.GetProfile(),
+		ClientCertificate: device.GetClientCertificate(),
+		ClientKey:         device.GetClientKey(),
+	}
+}
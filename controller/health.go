@@ -0,0 +1,99 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gopkg.in/mgo.v2"
+)
+
+// Time allowed to reach the database in the readiness check
+const readyStorageTimeout = 2 * time.Second
+
+// health serves the probes and the metrics of tviewer itself without
+// authentication. The network metrics reveal the topology, so they need
+// the viewer role.
+type health struct {
+}
+
+type healthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func (h health) registerRoutes(r *mux.Router) {
+	r.HandleFunc("/healthz", h.handleHealth).Methods("GET")
+	r.HandleFunc("/readyz", h.handleReady).Methods("GET")
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	r.HandleFunc("/api/metrics/network", requireRole(roleViewer, promhttp.HandlerFor(networkRegistry, promhttp.HandlerOpts{}).ServeHTTP)).Methods("GET")
+}
+
+// handleHealth answers as long as the process serves requests
+func (h health) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, healthStatus{Status: "ok"})
+}
+
+// handleReady checks that the database is reachable and that enough
+// collectors are streaming
+func (h health) handleReady(w http.ResponseWriter, r *http.Request) {
+	status := healthStatus{Status: "ready", Checks: make(map[string]string)}
+	ready := true
+
+	select {
+	case <-shuttingDown:
+		ready = false
+		status.Checks["shutdown"] = "shutting down"
+	default:
+	}
+
+	err := pingStorage()
+	if err != nil {
+		ready = false
+		status.Checks["storage"] = err.Error()
+	} else {
+		status.Checks["storage"] = "ok"
+	}
+
+	streaming := collectors.streaming()
+	required := currentConfig().ReadyCollectors
+	if streaming < required {
+		ready = false
+	}
+	status.Checks["collectors"] = fmt.Sprintf("%d streaming, %d required", streaming, required)
+
+	if !ready {
+		status.Status = "not ready"
+		writeJSON(w, http.StatusServiceUnavailable, status)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// pingStorage checks that the database answers
+func pingStorage() error {
+	session, err := mgo.DialWithTimeout(currentConfig().Database, readyStorageTimeout)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return session.Ping()
+}
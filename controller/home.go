@@ -18,19 +18,17 @@
 package controller
 
 import (
-	"html/template"
 	"net/http"
 	"github.com/gorilla/mux"
 )
 
 type home struct {
-	homeTemplate *template.Template
 }
 
 func (h home) registerRoutes(r *mux.Router) {
-	r.HandleFunc("/ng/home", h.handleHome)
+	r.HandleFunc("/ng/home", requireRole(roleViewer, h.handleHome))
 }
 
 func (h home) handleHome(w http.ResponseWriter, r *http.Request) {
-	h.homeTemplate.Execute(w, nil)
+	page("home.html").Execute(w, nil)
 }
@@ -0,0 +1,201 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Where the self-signed certificate is kept, in the base path, so browsers
+// only have to accept it once
+const selfSignedCertFile = "/tls/self-signed.pem"
+const selfSignedKeyFile = "/tls/self-signed-key.pem"
+
+// TLS configuration of the servers, nil when serving plain HTTP
+var serverTLSConfig *tls.Config
+
+// loadServerTLS builds serverTLSConfig from the configuration
+func loadServerTLS() error {
+	if currentConfig().TLSCert != "" {
+		certificate, err := tls.LoadX509KeyPair(currentConfig().TLSCert, currentConfig().TLSKey)
+		if err != nil {
+			return err
+		}
+		serverTLSConfig = newServerTLSConfig(certificate)
+		return nil
+	}
+	if currentConfig().TLSSelfSigned {
+		certificate, err := selfSignedCertificate()
+		if err != nil {
+			return err
+		}
+		serverTLSConfig = newServerTLSConfig(certificate)
+	}
+	return nil
+}
+
+func newServerTLSConfig(certificate tls.Certificate) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// selfSignedCertificate loads the stored self-signed certificate, or
+// generates a new one when there is none or it is about to expire
+func selfSignedCertificate() (tls.Certificate, error) {
+	certificate, err := tls.LoadX509KeyPair(currentConfig().BasePath + selfSignedCertFile, currentConfig().BasePath + selfSignedKeyFile)
+	if err == nil {
+		leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+		if (err == nil && time.Now().Add(24 * time.Hour).Before(leaf.NotAfter)) {
+			return certificate, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "tviewer", Organization: []string{"tviewer self-signed"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+	}
+	// Valid for the host name and every local address, labs are usually
+	// reached by IP
+	hostname, err := os.Hostname()
+	if (err == nil && hostname != "localhost") {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	addresses, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, address := range addresses {
+			if ipNet, ok := address.(*net.IPNet); ok {
+				template.IPAddresses = append(template.IPAddresses, ipNet.IP)
+			}
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	_ = os.Mkdir(currentConfig().BasePath + "/tls", 0700)
+	err = ioutil.WriteFile(currentConfig().BasePath + selfSignedKeyFile, keyPEM, 0600)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("cannot save self-signed key: %v", err)
+	}
+	err = ioutil.WriteFile(currentConfig().BasePath + selfSignedCertFile, certPEM, 0644)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("cannot save self-signed certificate: %v", err)
+	}
+	log.Printf("Generated a self-signed certificate in %s, valid until %s", currentConfig().BasePath + selfSignedCertFile, template.NotAfter.Format(time.RFC3339))
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// redirectHTTPS sends plain HTTP requests to the same URL over HTTPS
+func redirectHTTPS(w http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	_, port, err := net.SplitHostPort(currentConfig().HTTPSListen)
+	if (err == nil && port != "443") {
+		host = net.JoinHostPort(host, port)
+	}
+	http.Redirect(w, r, "https://" + host + r.URL.RequestURI(), http.StatusMovedPermanently)
+}
+
+// displayAddress fills in the host of listen addresses like ":9090"
+func displayAddress(address string) string {
+	if strings.HasPrefix(address, ":") {
+		return "0.0.0.0" + address
+	}
+	return address
+}
+
+// Web servers, drained by Shutdown
+var webServers []*http.Server
+var webServersMutex sync.Mutex
+
+func newWebServer(address string, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:    address,
+		Handler: handler,
+	}
+	webServersMutex.Lock()
+	webServers = append(webServers, server)
+	webServersMutex.Unlock()
+	return server
+}
+
+// ListenAndServe serves the web UI and REST API, over HTTPS when a
+// certificate is configured. Startup must have been called. It returns
+// http.ErrServerClosed after Shutdown.
+func ListenAndServe(handler http.Handler) error {
+	config := currentConfig()
+	if serverTLSConfig == nil {
+		server := newWebServer(config.HTTPListen, handler)
+		log.Println("Listening in http://" + displayAddress(config.HTTPListen) + "/web/")
+		return server.ListenAndServe()
+	}
+
+	redirect := newWebServer(config.HTTPListen, http.HandlerFunc(redirectHTTPS))
+	go func() {
+		log.Println("Redirecting http://" + displayAddress(config.HTTPListen) + " to HTTPS")
+		err := redirect.ListenAndServe()
+		if err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	server := newWebServer(config.HTTPSListen, handler)
+	server.TLSConfig = serverTLSConfig
+	log.Println("Listening in https://" + displayAddress(config.HTTPSListen) + "/web/")
+	return server.ListenAndServeTLS("", "")
+}
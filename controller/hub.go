@@ -0,0 +1,391 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+	"github.com/sfloresk/tviewer/model"
+)
+
+const (
+	// Messages queued per client before it is considered too slow and evicted
+	clientSendQueueSize = 16
+	// Topology versions kept so reconnecting clients can resume
+	topologyHistorySize = 100
+)
+
+// Messages exchanged with the clients. The server sends a snapshot when a
+// client connects, subscribes or asks for a resync, and a patch from
+// baseVersion to version on every change of the part the client subscribed to.
+const (
+	messageSnapshot  = "snapshot"
+	messagePatch     = "patch"
+	messageError     = "error"
+	messageResync    = "resync"
+	messageSubscribe = "subscribe"
+	// Operator actions: {"type": "annotate", "node": "...", "text": "..."}
+	// (empty text removes the annotation) and {"type": "restart", "node": "..."}
+	messageAnnotate  = "annotate"
+	messageRestart   = "restart"
+)
+
+type snapshotMessage struct {
+	Type    string       `json:"type"`
+	Version uint64       `json:"version"`
+	Data    []model.Node `json:"data"`
+}
+
+type patchMessage struct {
+	Type        string           `json:"type"`
+	Version     uint64           `json:"version"`
+	BaseVersion uint64           `json:"baseVersion"`
+	Ops         []patchOperation `json:"ops"`
+}
+
+type errorMessage struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// hubMessage is an encoded message waiting in a client queue. ID identifies
+// the topology version for snapshots and patches and is empty otherwise.
+type hubMessage struct {
+	Type string
+	ID   string
+	Data []byte
+}
+
+type subscription struct {
+	client *hubClient
+	filter *topologyFilter
+}
+
+// clientError is reported to the client as an error message
+type clientError struct {
+	client *hubClient
+	err    error
+}
+
+type historyEntry struct {
+	version uint64
+	nodes   []model.Node
+}
+
+// hub owns the set of clients and the versioned topology. All changes go
+// through its channels, so only the run goroutine touches them.
+type hub struct {
+	clients    map[*hubClient]bool
+	register   chan *hubClient
+	unregister chan *hubClient
+	resync     chan *hubClient
+	subscribe  chan subscription
+	fail       chan clientError
+	update     chan []model.Node
+	current    chan chan historyEntry
+	closeAll   chan chan struct{}
+
+	// Versions restart with the process, the epoch tells them apart
+	epoch    int64
+	version  uint64
+	nodes    []model.Node
+	document interface{}
+	history  []historyEntry
+}
+
+// hubClient is a subscriber with its own outbound queue. The transport
+// (websocket or server-sent events) drains send until the hub closes it.
+type hubClient struct {
+	addr string
+	send chan hubMessage
+	// Legacy clients get the whole []model.Node on every change
+	fullSnapshots bool
+
+	// Set before registering to resume from a version the client already has
+	lastID string
+
+	// Owned by the hub: the subscription and the last view sent
+	filter   *topologyFilter
+	version  uint64
+	document interface{}
+}
+
+func newHub() *hub {
+	return &hub{
+		clients:    make(map[*hubClient]bool),
+		register:   make(chan *hubClient),
+		unregister: make(chan *hubClient),
+		resync:     make(chan *hubClient),
+		subscribe:  make(chan subscription),
+		fail:       make(chan clientError),
+		update:     make(chan []model.Node),
+		current:    make(chan chan historyEntry),
+		closeAll:   make(chan chan struct{}),
+		epoch:      time.Now().UnixNano(),
+		nodes:      make([]model.Node, 0),
+		document:   make([]interface{}, 0),
+	}
+}
+
+func newHubClient(addr string, fullSnapshots bool) *hubClient {
+	return &hubClient{
+		addr:          addr,
+		send:          make(chan hubMessage, clientSendQueueSize),
+		fullSnapshots: fullSnapshots,
+	}
+}
+
+func (h *hub) run() {
+	for {
+		select {
+		case client := <-h.register:
+			h.clients[client] = true
+			if client.lastID == "" || !h.resumeClient(client) {
+				h.sendSnapshot(client)
+			}
+		case client := <-h.unregister:
+			h.removeClient(client)
+		case client := <-h.resync:
+			if h.clients[client] {
+				h.sendSnapshot(client)
+			}
+		case subscription := <-h.subscribe:
+			h.applySubscription(subscription)
+		case failure := <-h.fail:
+			if h.clients[failure.client] {
+				h.sendError(failure.client, failure.err)
+			}
+		case nodes := <-h.update:
+			h.applyUpdate(nodes)
+		case reply := <-h.current:
+			reply <- historyEntry{version: h.version, nodes: h.nodes}
+		case done := <-h.closeAll:
+			for client := range h.clients {
+				h.removeClient(client)
+			}
+			close(done)
+		}
+	}
+}
+
+// applyUpdate bumps the version and sends every client the delta of the part
+// of the topology it subscribed to
+func (h *hub) applyUpdate(nodes []model.Node) {
+	document, err := toJSONDocument(nodes)
+	if err != nil {
+		log.Printf("Cannot encode topology: %v", err)
+		return
+	}
+	ops := diffJSON(h.document, document)
+	if len(ops) == 0 {
+		return
+	}
+	h.version++
+	h.nodes = nodes
+	h.document = document
+	h.history = append(h.history, historyEntry{version: h.version, nodes: nodes})
+	if len(h.history) > topologyHistorySize {
+		h.history = h.history[len(h.history) - topologyHistorySize:]
+	}
+
+	// Unfiltered clients share the topology wide delta, encoded once
+	var shared []byte
+	for client := range h.clients {
+		if client.filter == nil && !client.fullSnapshots && client.version == h.version - 1 {
+			if shared == nil {
+				shared, err = json.Marshal(patchMessage{
+					Type:        messagePatch,
+					Version:     h.version,
+					BaseVersion: h.version - 1,
+					Ops:         ops,
+				})
+				if err != nil {
+					log.Printf("Cannot encode topology patch: %v", err)
+					return
+				}
+			}
+			h.queue(client, hubMessage{Type: messagePatch, ID: h.versionID(), Data: shared})
+			client.version = h.version
+			client.document = document
+			continue
+		}
+		h.sendChanges(client)
+	}
+}
+
+// sendChanges sends the client what changed in its view since the last
+// message it got, if anything did
+func (h *hub) sendChanges(client *hubClient) {
+	view := h.view(client)
+	document, err := toJSONDocument(view)
+	if err != nil {
+		log.Printf("Cannot encode topology: %v", err)
+		return
+	}
+	ops := diffJSON(client.document, document)
+	if len(ops) == 0 {
+		// Nothing changed in the subscribed part
+		return
+	}
+	if client.fullSnapshots {
+		h.sendJSON(client, messageSnapshot, view)
+	} else {
+		h.sendJSON(client, messagePatch, patchMessage{
+			Type:        messagePatch,
+			Version:     h.version,
+			BaseVersion: client.version,
+			Ops:         ops,
+		})
+	}
+	client.version = h.version
+	client.document = document
+}
+
+// resumeClient brings a reconnecting client from the version in
+// client.lastID to the current one with a single patch. It fails if that
+// version is from another process or no longer in the history.
+func (h *hub) resumeClient(client *hubClient) bool {
+	var epoch int64
+	var lastVersion uint64
+	if _, err := fmt.Sscanf(client.lastID, "%d-%d", &epoch, &lastVersion); err != nil || epoch != h.epoch {
+		return false
+	}
+	for _, entry := range h.history {
+		if entry.version != lastVersion {
+			continue
+		}
+		nodes := entry.nodes
+		if client.filter != nil {
+			nodes = client.filter.apply(nodes)
+		}
+		document, err := toJSONDocument(nodes)
+		if err != nil {
+			log.Printf("Cannot encode topology: %v", err)
+			return false
+		}
+		client.version = entry.version
+		client.document = document
+		h.sendChanges(client)
+		return true
+	}
+	return false
+}
+
+// snapshot returns the current version and topology. Safe to call from any
+// goroutine.
+func (h *hub) snapshot() (uint64, []model.Node) {
+	reply := make(chan historyEntry, 1)
+	h.current <- reply
+	entry := <-reply
+	return entry.version, entry.nodes
+}
+
+// disconnectAll closes the queue of every client, so the transports finish
+// their connections. Used on shutdown.
+func (h *hub) disconnectAll() {
+	done := make(chan struct{})
+	h.closeAll <- done
+	<-done
+}
+
+// view is the part of the topology the client subscribed to
+func (h *hub) view(client *hubClient) []model.Node {
+	if client.filter == nil {
+		return h.nodes
+	}
+	return client.filter.apply(h.nodes)
+}
+
+func (h *hub) sendSnapshot(client *hubClient) {
+	view := h.view(client)
+	document, err := toJSONDocument(view)
+	if err != nil {
+		log.Printf("Cannot encode topology: %v", err)
+		return
+	}
+	if client.fullSnapshots {
+		h.sendJSON(client, messageSnapshot, view)
+	} else {
+		h.sendJSON(client, messageSnapshot, snapshotMessage{
+			Type:    messageSnapshot,
+			Version: h.version,
+			Data:    view,
+		})
+	}
+	client.version = h.version
+	client.document = document
+}
+
+func (h *hub) applySubscription(subscription subscription) {
+	client := subscription.client
+	if !h.clients[client] {
+		return
+	}
+	filter := subscription.filter
+	if filter != nil {
+		if err := filter.validate(); err != nil {
+			h.sendError(client, err)
+			return
+		}
+		if filter.isEmpty() {
+			filter = nil
+		}
+	}
+	client.filter = filter
+	h.sendSnapshot(client)
+}
+
+func (h *hub) sendError(client *hubClient, err error) {
+	message, _ := json.Marshal(errorMessage{Type: messageError, Message: err.Error()})
+	h.queue(client, hubMessage{Type: messageError, Data: message})
+}
+
+// sendJSON queues a snapshot or patch for the current version
+func (h *hub) sendJSON(client *hubClient, messageType string, v interface{}) {
+	message, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Cannot encode topology message: %v", err)
+		return
+	}
+	h.queue(client, hubMessage{Type: messageType, ID: h.versionID(), Data: message})
+}
+
+func (h *hub) versionID() string {
+	return fmt.Sprintf("%d-%d", h.epoch, h.version)
+}
+
+// queue never blocks the hub. A client whose queue is full is evicted.
+func (h *hub) queue(client *hubClient, message hubMessage) {
+	select {
+	case client.send <- message:
+		metricBroadcasts.WithLabelValues(message.Type).Inc()
+	default:
+		log.Printf("Evicting slow topology client %v", client.addr)
+		h.removeClient(client)
+	}
+}
+
+func (h *hub) removeClient(client *hubClient) {
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		// Closing the queue tells the transport to finish the connection
+		close(client.send)
+	}
+}
@@ -18,13 +18,11 @@
 package controller
 
 import (
-	"html/template"
 	"net/http"
 	"github.com/gorilla/mux"
 )
 
 type index struct {
-	indexTemplate *template.Template
 }
 
 func (h index) registerRoutes(r *mux.Router) {
@@ -37,5 +35,5 @@ func (h index) registerRoutes(r *mux.Router) {
 }
 
 func (h index) handleIndex(w http.ResponseWriter, r *http.Request) {
-	h.indexTemplate.Execute(w, nil)
+	page("index.html").Execute(w, nil)
 }
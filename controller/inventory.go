@@ -0,0 +1,291 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"io"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"github.com/sfloresk/tviewer/model"
+	"gopkg.in/yaml.v2"
+)
+
+var importFile = flag.String("import", "", "Inventory (CSV or YAML) to onboard at startup")
+var importSkipExisting = flag.Bool("import-skip-existing", false, "Skip inventory devices whose name or IP is already in use")
+
+// Inventory formats
+const (
+	formatCSV  = "csv"
+	formatYAML = "yaml"
+)
+
+// Import result status
+const (
+	importStarted = "started"
+	importSkipped = "skipped"
+	importFailed  = "failed"
+)
+
+// credentials are the username and password shared by the devices of a
+// profile
+type credentials struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// inventoryDevice is a device as listed in an inventory. Username and
+// password, if set, take precedence over a profile of the inventory. Other
+// profiles are the stored credential profiles. Certificate is the PEM itself
+// and Cert a path to it, only read for inventories given with -import.
+type inventoryDevice struct {
+	Name           string   `yaml:"name"`
+	Ip             string   `yaml:"ip"`
+	Port           string   `yaml:"port"`
+	Profile        string   `yaml:"profile"`
+	Username       string   `yaml:"username"`
+	Password       string   `yaml:"password"`
+	Cert           string   `yaml:"cert"`
+	Certificate    string   `yaml:"certificate"`
+	Tags           []string `yaml:"tags"`
+	SampleInterval int      `yaml:"sampleInterval"`
+	// Set for devices from the inventory sync
+	Source string `yaml:"-"`
+}
+
+// inventory is the content of a CSV or YAML inventory. Only YAML inventories
+// can define profiles of their own.
+type inventory struct {
+	Profiles map[string]credentials `yaml:"profiles"`
+	Devices  []inventoryDevice      `yaml:"devices"`
+}
+
+// importResult is the outcome of one device of an inventory
+type importResult struct {
+	Row    int    `json:"row"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Job    string `json:"job,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// inventoryFormat guesses the format from the file name or the content type
+func inventoryFormat(name string, contentType string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return formatCSV
+	case ".yaml", ".yml":
+		return formatYAML
+	}
+	if strings.Contains(contentType, "csv") {
+		return formatCSV
+	}
+	if strings.Contains(contentType, "yaml") {
+		return formatYAML
+	}
+	return ""
+}
+
+func parseInventory(raw []byte, format string) (inventory, error) {
+	var result inventory
+	switch format {
+	case formatYAML:
+		if err := yaml.UnmarshalStrict(raw, &result); err != nil {
+			return result, newServiceError(errorInvalid, "Invalid YAML inventory: %v", err)
+		}
+		return result, nil
+	case formatCSV:
+		return parseCSVInventory(raw)
+	}
+	return result, newServiceError(errorInvalid, "Unknown inventory format %q, use csv or yaml", format)
+}
+
+// parseCSVInventory reads a CSV inventory with a header row. Tags are
+// separated by ';'.
+func parseCSVInventory(raw []byte) (inventory, error) {
+	var result inventory
+
+	reader := csv.NewReader(bytes.NewReader(raw))
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return result, newServiceError(errorInvalid, "Invalid CSV inventory: %v", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, newServiceError(errorInvalid, "Invalid CSV inventory: %v", err)
+		}
+
+		var device inventoryDevice
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			switch header[i] {
+			case "name":
+				device.Name = value
+			case "ip":
+				device.Ip = value
+			case "port":
+				device.Port = value
+			case "profile":
+				device.Profile = value
+			case "username":
+				device.Username = value
+			case "password":
+				device.Password = value
+			case "cert":
+				device.Cert = value
+			case "certificate":
+				device.Certificate = value
+			case "tags":
+				for _, tag := range strings.Split(value, ";") {
+					if tag = strings.TrimSpace(tag); tag != "" {
+						device.Tags = append(device.Tags, tag)
+					}
+				}
+			case "sampleinterval":
+				if value != "" {
+					device.SampleInterval, err = strconv.Atoi(value)
+					if err != nil {
+						return result, newServiceError(errorInvalid, "Invalid sample interval %q for %v", value, device.Name)
+					}
+				}
+			default:
+				return result, newServiceError(errorInvalid, "Unknown CSV inventory column %q", header[i])
+			}
+		}
+		result.Devices = append(result.Devices, device)
+	}
+	return result, nil
+}
+
+// device resolves the credentials and the certificate of an inventory
+// device. Certificate paths are read relative to baseDir, and refused when
+// baseDir is empty, e.g. for inventories posted to the API.
+func (i inventoryDevice) device(profiles map[string]credentials, baseDir string) (model.Device, error) {
+	device := model.Device{
+		Name:           i.Name,
+		Ip:             i.Ip,
+		Port:           i.Port,
+		Username:       i.Username,
+		Password:       i.Password,
+		Tags:           i.Tags,
+		SampleInterval: i.SampleInterval,
+		Source:         i.Source,
+	}
+
+	if profile, ok := profiles[i.Profile]; ok && i.Profile != "" {
+		if device.Username == "" {
+			device.Username = profile.Username
+		}
+		if device.Password == "" {
+			device.Password = profile.Password
+		}
+	} else {
+		// A stored credential profile, resolved when onboarding
+		device.Profile = i.Profile
+	}
+
+	if i.Certificate != "" {
+		device.Certificate = i.Certificate
+		return device, nil
+	}
+	if i.Cert == "" {
+		if device.Profile != "" {
+			// The profile may have the certificate
+			return device, nil
+		}
+		return device, newServiceError(errorInvalid, "Certificate is required")
+	}
+	if baseDir == "" {
+		return device, newServiceError(errorInvalid, "Certificate paths are only read with -import, send the PEM in certificate")
+	}
+	path := i.Cert
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	certificate, err := ioutil.ReadFile(path)
+	if err != nil {
+		return device, newServiceError(errorInvalid, "Cannot read certificate: %v", err)
+	}
+	device.Certificate = string(certificate)
+	return device, nil
+}
+
+// importInventory starts an onboarding job for every device of the
+// inventory. With skipExisting, devices whose name or IP is in use are
+// skipped instead of failed.
+func importInventory(inv inventory, baseDir string, skipExisting bool, telemetryChannel chan model.TelemetryWrapper, actor string) []importResult {
+	results := make([]importResult, 0, len(inv.Devices))
+	for i, row := range inv.Devices {
+		result := importResult{Row: i + 1, Name: row.Name}
+
+		device, err := row.device(inv.Profiles, baseDir)
+		if err == nil {
+			var job onboardingJob
+			job, err = startOnboarding(device, telemetryChannel, actor)
+			result.Job = job.ID
+		}
+		switch {
+		case err == nil:
+			result.Status = importStarted
+		case skipExisting && kindOf(err) == errorConflict:
+			result.Status = importSkipped
+			result.Error = err.Error()
+		default:
+			result.Status = importFailed
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// importInventoryFile imports the inventory given with -import and logs the
+// result of every device. Onboarding goes on in the background.
+func importInventoryFile(path string, skipExisting bool, telemetryChannel chan model.TelemetryWrapper) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Printf("Cannot read inventory: %v", err)
+		return
+	}
+	inv, err := parseInventory(raw, inventoryFormat(path, ""))
+	if err != nil {
+		log.Printf("Cannot import %v: %v", path, err)
+		return
+	}
+	for _, result := range importInventory(inv, filepath.Dir(path), skipExisting, telemetryChannel, actorSystem) {
+		if result.Error != "" {
+			log.Printf("Inventory row %v (%v): %v, %v", result.Row, result.Name, result.Status, result.Error)
+		} else {
+			log.Printf("Inventory row %v (%v): %v, job %v", result.Row, result.Name, result.Status, result.Job)
+		}
+	}
+}
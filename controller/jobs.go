@@ -0,0 +1,298 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+	"github.com/sfloresk/tviewer/model"
+)
+
+// Job status
+const (
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+// Number of finished jobs kept for clients that ask for them later
+const jobHistorySize = 100
+
+// Onboardings running at the same time, e.g. during a bulk import. The
+// other jobs wait with all their steps pending.
+const maxConcurrentOnboardings = 8
+
+var onboardingSlots = make(chan struct{}, maxConcurrentOnboardings)
+
+type jobStep struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// onboardingJob is the progress of a device being added in the background
+type onboardingJob struct {
+	ID       string     `json:"id"`
+	Device   string     `json:"device"`
+	Status   string     `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	Steps    []jobStep  `json:"steps"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+// copy returns a job that does not share its steps with j
+func (j *onboardingJob) copy() onboardingJob {
+	result := *j
+	result.Steps = append([]jobStep(nil), j.Steps...)
+	return result
+}
+
+// jobRegistry holds the onboarding jobs and pushes every change to the
+// watchers, e.g. websocket clients
+type jobRegistry struct {
+	mu       sync.Mutex
+	jobs     map[string]*onboardingJob
+	order    []string
+	watchers map[chan onboardingJob]bool
+	// Names and IPs of the devices being onboarded, see reserve
+	reserved map[string]bool
+}
+
+var jobs = jobRegistry{
+	jobs:     make(map[string]*onboardingJob),
+	watchers: make(map[chan onboardingJob]bool),
+	reserved: make(map[string]bool),
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startOnboarding validates the device and onboards it in the background,
+// starting its collectors if everything goes well. Validation errors are
+// returned right away.
+func startOnboarding(device model.Device, telemetryChannel chan model.TelemetryWrapper, actor string) (onboardingJob, error) {
+	o := newOnboarding(device, actor)
+	if err := jobs.reserve(device.Name, device.Ip); err != nil {
+		o.audit(err)
+		return onboardingJob{}, err
+	}
+	if err := o.runNext(1); err != nil {
+		jobs.release(device.Name, device.Ip)
+		o.audit(err)
+		return onboardingJob{}, err
+	}
+	job := jobs.create(device, o.stepNames())
+	jobs.setStep(job.ID, stepValidate, stepDone, nil)
+	o.report = func(step string, status string, err error) {
+		jobs.setStep(job.ID, step, status, err)
+	}
+
+	go func() {
+		onboardingSlots <- struct{}{}
+		defer func() {
+			<-onboardingSlots
+		}()
+
+		err := o.run()
+		o.audit(err)
+		if err == nil {
+			collectors.start(o.device, telemetryChannel)
+		}
+		// The device is stored or rolled back, clients may retry once the
+		// job is finished
+		jobs.release(device.Name, device.Ip)
+		jobs.finish(job.ID, err)
+	}()
+	return jobs.get(job.ID)
+}
+
+func (r *jobRegistry) create(device model.Device, steps []string) onboardingJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job := &onboardingJob{
+		ID:      newJobID(),
+		Device:  device.Name,
+		Status:  jobRunning,
+		Created: time.Now(),
+	}
+	for _, step := range steps {
+		job.Steps = append(job.Steps, jobStep{Name: step, Status: stepPending})
+	}
+	r.jobs[job.ID] = job
+	r.order = append(r.order, job.ID)
+	r.prune()
+	r.publish(job)
+	return job.copy()
+}
+
+// prune forgets the oldest finished jobs beyond jobHistorySize
+func (r *jobRegistry) prune() {
+	for i := 0; len(r.order) > jobHistorySize && i < len(r.order); {
+		if r.jobs[r.order[i]].Status == jobRunning {
+			i++
+			continue
+		}
+		delete(r.jobs, r.order[i])
+		r.order = append(r.order[:i], r.order[i+1:]...)
+	}
+}
+
+func (r *jobRegistry) setStep(id string, step string, status string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return
+	}
+	for i := range job.Steps {
+		if job.Steps[i].Name == step {
+			job.Steps[i].Status = status
+			job.Steps[i].Error = ""
+			if err != nil {
+				job.Steps[i].Error = err.Error()
+			}
+		}
+	}
+	r.publish(job)
+}
+
+func (r *jobRegistry) finish(id string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	job.Finished = &now
+	job.Status = jobSucceeded
+	if err != nil {
+		job.Status = jobFailed
+		job.Error = err.Error()
+	}
+	log.Printf("Onboarding job %v for %v %v", job.ID, job.Device, job.Status)
+	r.publish(job)
+}
+
+func (r *jobRegistry) get(id string) (onboardingJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return onboardingJob{}, newServiceError(errorNotFound, "Job %v not found", id)
+	}
+	return job.copy(), nil
+}
+
+// list returns the jobs, oldest first
+func (r *jobRegistry) list() []onboardingJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]onboardingJob, 0, len(r.order))
+	for _, id := range r.order {
+		result = append(result, r.jobs[id].copy())
+	}
+	return result
+}
+
+// reserve claims the name and IP of a device until release is called. It
+// fails if another onboarding holds either of them, so two requests for the
+// same device cannot both pass validation.
+func (r *jobRegistry) reserve(name string, ip string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.reserved["name:" + name] || r.reserved["ip:" + ip] {
+		return newServiceError(errorConflict, "Device %v or IP %v is already being onboarded", name, ip)
+	}
+	r.reserved["name:" + name] = true
+	r.reserved["ip:" + ip] = true
+	return nil
+}
+
+func (r *jobRegistry) release(name string, ip string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.reserved, "name:" + name)
+	delete(r.reserved, "ip:" + ip)
+}
+
+// onboarding tells if an onboarding holds this name or IP
+func (r *jobRegistry) onboarding(name string, ip string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.reserved["name:" + name] || r.reserved["ip:" + ip]
+}
+
+// watch returns a channel that receives every job change. Watchers that do
+// not keep up have their channel closed.
+func (r *jobRegistry) watch() chan onboardingJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	watcher := make(chan onboardingJob, clientSendQueueSize)
+	r.watchers[watcher] = true
+	return watcher
+}
+
+func (r *jobRegistry) unwatch(watcher chan onboardingJob) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.watchers[watcher] {
+		delete(r.watchers, watcher)
+		close(watcher)
+	}
+}
+
+// closeWatchers closes the channel of every watcher, on shutdown
+func (r *jobRegistry) closeWatchers() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for watcher := range r.watchers {
+		delete(r.watchers, watcher)
+		close(watcher)
+	}
+}
+
+// publish must be called with r.mu held
+func (r *jobRegistry) publish(job *onboardingJob) {
+	for watcher := range r.watchers {
+		select {
+		case watcher <- job.copy():
+		default:
+			delete(r.watchers, watcher)
+			close(watcher)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// patchOperation is a single RFC 6902 operation. Only add, remove and
+// replace are produced.
+type patchOperation struct {
+	Op    string
+	Path  string
+	Value interface{}
+}
+
+func (p patchOperation) MarshalJSON() ([]byte, error) {
+	if p.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{p.Op, p.Path})
+	}
+	// Value must be present for add and replace, even when it is null
+	return json.Marshal(struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	}{p.Op, p.Path, p.Value})
+}
+
+// toJSONDocument converts v into the generic form produced by encoding/json
+// (maps, slices and scalars) so two documents can be compared field by field.
+func toJSONDocument(v interface{}) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var document interface{}
+	err = json.Unmarshal(raw, &document)
+	return document, err
+}
+
+// diffJSON returns the operations that turn the document a into b. Both must
+// come from toJSONDocument.
+func diffJSON(a, b interface{}) []patchOperation {
+	return appendDiff(make([]patchOperation, 0), "", a, b)
+}
+
+func appendDiff(ops []patchOperation, path string, a, b interface{}) []patchOperation {
+	switch aValue := a.(type) {
+	case map[string]interface{}:
+		bValue, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for key, aChild := range aValue {
+			childPath := path + "/" + escapePointer(key)
+			if bChild, ok := bValue[key]; ok {
+				ops = appendDiff(ops, childPath, aChild, bChild)
+			} else {
+				ops = append(ops, patchOperation{Op: "remove", Path: childPath})
+			}
+		}
+		for key, bChild := range bValue {
+			if _, ok := aValue[key]; !ok {
+				ops = append(ops, patchOperation{Op: "add", Path: path + "/" + escapePointer(key), Value: bChild})
+			}
+		}
+		return ops
+	case []interface{}:
+		bValue, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		common := len(aValue)
+		if len(bValue) < common {
+			common = len(bValue)
+		}
+		for i := 0; i < common; i++ {
+			ops = appendDiff(ops, path + "/" + strconv.Itoa(i), aValue[i], bValue[i])
+		}
+		// Remove from the end so earlier indexes stay valid
+		for i := len(aValue) - 1; i >= common; i-- {
+			ops = append(ops, patchOperation{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+		}
+		for i := common; i < len(bValue); i++ {
+			ops = append(ops, patchOperation{Op: "add", Path: path + "/-", Value: bValue[i]})
+		}
+		return ops
+	}
+	if !reflect.DeepEqual(a, b) {
+		ops = append(ops, patchOperation{Op: "replace", Path: path, Value: b})
+	}
+	return ops
+}
+
+// escapePointer escapes a key as a JSON Pointer reference token (RFC 6901)
+func escapePointer(key string) string {
+	return strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1)
+}
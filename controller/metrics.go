@@ -0,0 +1,62 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics of tviewer itself, served on /metrics with the Go runtime ones
+var (
+	metricWebsocketClients = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tviewer_websocket_clients",
+		Help: "Open websocket connections, by stream.",
+	}, []string{"stream"})
+	metricBroadcasts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tviewer_broadcasts_sent_total",
+		Help: "Topology messages queued to websocket, SSE and gRPC clients, by type.",
+	}, []string{"type"})
+	metricTopologyRebuild = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "tviewer_topology_rebuild_seconds",
+		Help:    "Time taken to rebuild the topology from the database.",
+		Buckets: prometheus.DefBuckets,
+	})
+	metricTelemetryMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tviewer_telemetry_messages_total",
+		Help: "Telemetry messages received from devices, by subscription.",
+	}, []string{"subscription"})
+	metricDecodeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tviewer_telemetry_decode_errors_total",
+		Help: "Telemetry messages or rows that could not be decoded, by subscription.",
+	}, []string{"subscription"})
+	metricCollectorsStreaming = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "tviewer_collectors_streaming",
+		Help: "Telemetry subscriptions that received data and are still open.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		metricWebsocketClients,
+		metricBroadcasts,
+		metricTopologyRebuild,
+		metricTelemetryMessages,
+		metricDecodeErrors,
+		metricCollectorsStreaming,
+	)
+}
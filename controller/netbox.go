@@ -0,0 +1,330 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"github.com/sfloresk/tviewer/model"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Source of the devices added by the inventory sync
+const sourceNetbox = "netbox"
+
+// Page size asked to the API
+const netboxPageSize = 100
+
+// netboxDevice holds the fields of a NetBox device that tviewer uses
+type netboxDevice struct {
+	Name       string `json:"name"`
+	PrimaryIP4 *struct {
+		Address string `json:"address"`
+	} `json:"primary_ip4"`
+	// Strings in old NetBox versions, objects with name and slug in new ones
+	Tags         []json.RawMessage      `json:"tags"`
+	CustomFields map[string]interface{} `json:"custom_fields"`
+}
+
+type netboxPage struct {
+	Next    *string        `json:"next"`
+	Results []netboxDevice `json:"results"`
+}
+
+// syncReport is the outcome of an inventory sync
+type syncReport struct {
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished"`
+	Error    string         `json:"error,omitempty"`
+	Onboard  []importResult `json:"onboard"`
+	// Synced devices no longer in the source of truth
+	Flagged []string `json:"flagged"`
+	// Flagged devices that are back
+	Restored []string `json:"restored"`
+}
+
+// inventorySync runs one sync at a time and keeps the last report
+type inventorySync struct {
+	mu       sync.Mutex
+	reportMu sync.Mutex
+	last     *syncReport
+}
+
+var netboxSync = inventorySync{}
+
+// runInventorySync syncs now and then every netboxInterval, forever. The
+// interval is read after each sync, so a reload applies to the next one.
+func runInventorySync(telemetryChannel chan model.TelemetryWrapper) {
+	for {
+		netboxSync.sync(telemetryChannel)
+		interval, _ := time.ParseDuration(currentConfig().NetboxInterval)
+		time.Sleep(interval)
+	}
+}
+
+func (s *inventorySync) lastReport() *syncReport {
+	s.reportMu.Lock()
+	defer s.reportMu.Unlock()
+	return s.last
+}
+
+// sync onboards the devices of the source of truth that tviewer does not
+// have and flags for decommission the synced devices that are gone from it.
+// Devices are never decommissioned automatically.
+func (s *inventorySync) sync(telemetryChannel chan model.TelemetryWrapper) syncReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := syncReport{Started: time.Now(), Onboard: []importResult{}, Flagged: []string{}, Restored: []string{}}
+	err := s.run(&report, telemetryChannel)
+	if err != nil {
+		log.Printf("Inventory sync failed: %v", err)
+		report.Error = err.Error()
+	}
+	report.Finished = time.Now()
+
+	s.reportMu.Lock()
+	s.last = &report
+	s.reportMu.Unlock()
+	return report
+}
+
+func (s *inventorySync) run(report *syncReport, telemetryChannel chan model.TelemetryWrapper) error {
+	remote, err := fetchNetboxDevices()
+	if err != nil {
+		return err
+	}
+	current, err := listDevices()
+	if err != nil {
+		return err
+	}
+
+	plan := planSync(remote, current)
+
+	session, dbCollection, err := openDevicesCollection()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	for _, name := range plan.flag {
+		err = dbCollection.Update(bson.M{"name": name}, bson.M{"$set": bson.M{"decommissionpending": true}})
+		if err != nil {
+			return fmt.Errorf("cannot update device table: %v", err)
+		}
+		log.Printf("Device %v is no longer in the inventory, flagged for decommission", name)
+		report.Flagged = append(report.Flagged, name)
+	}
+	for _, name := range plan.restore {
+		err = dbCollection.Update(bson.M{"name": name}, bson.M{"$set": bson.M{"decommissionpending": false}})
+		if err != nil {
+			return fmt.Errorf("cannot update device table: %v", err)
+		}
+		report.Restored = append(report.Restored, name)
+	}
+
+	report.Onboard = importInventory(plan.onboard, netboxCertDirectory(), true, telemetryChannel, actorNetboxSync)
+	for _, result := range plan.rejected {
+		result.Row = len(report.Onboard) + 1
+		log.Printf("Cannot onboard %v from the inventory: %v", result.Name, result.Error)
+		report.Onboard = append(report.Onboard, result)
+	}
+	return nil
+}
+
+// syncPlan is what a sync changes in the stored devices
+type syncPlan struct {
+	// Devices of the source of truth that tviewer does not have
+	onboard inventory
+	// Synced devices gone from the source of truth, and flagged ones that
+	// are back
+	flag    []string
+	restore []string
+	// Devices of the source of truth that cannot be onboarded
+	rejected []importResult
+}
+
+// planSync compares the devices of the source of truth with the stored ones.
+// Stored devices are never onboarded again, whatever their source, and only
+// synced devices are flagged.
+func planSync(remote []netboxDevice, current []model.Device) syncPlan {
+	var plan syncPlan
+
+	known := make(map[string]bool)
+	for _, device := range remote {
+		known[device.Name] = true
+	}
+
+	existing := make(map[string]bool)
+	for _, device := range current {
+		existing[device.Name] = true
+		if device.Source != sourceNetbox {
+			continue
+		}
+		gone := !known[device.Name]
+		if gone == device.DecommissionPending {
+			continue
+		}
+		if gone {
+			plan.flag = append(plan.flag, device.Name)
+		} else {
+			plan.restore = append(plan.restore, device.Name)
+		}
+	}
+
+	for _, device := range remote {
+		if existing[device.Name] {
+			continue
+		}
+		row, err := device.inventoryDevice()
+		if err != nil {
+			plan.rejected = append(plan.rejected, importResult{Name: device.Name, Status: importFailed, Error: err.Error()})
+			continue
+		}
+		plan.onboard.Devices = append(plan.onboard.Devices, row)
+	}
+	return plan
+}
+
+// netboxCertDirectory is netboxCertDir, or inventory-certs in the base path
+func netboxCertDirectory() string {
+	config := currentConfig()
+	if config.NetboxCertDir == "" {
+		return config.BasePath + "/inventory-certs"
+	}
+	return config.NetboxCertDir
+}
+
+// inventoryDevice maps the NetBox device to an inventory entry. Credentials
+// come from the credential profile in the tviewer_profile custom field, or
+// else from the NETBOX_DEVICE_USERNAME and NETBOX_DEVICE_PASSWORD variables.
+// Names that would read a certificate outside of the directory are rejected.
+func (n netboxDevice) inventoryDevice() (inventoryDevice, error) {
+	if strings.ContainsAny(n.Name, `/\`) || strings.Contains(n.Name, "..") {
+		return inventoryDevice{}, newServiceError(errorInvalid, "Device name %q cannot contain path separators or ..", n.Name)
+	}
+	device := inventoryDevice{
+		Name:     n.Name,
+		Port:     currentConfig().NetboxPort,
+		Username: os.Getenv("NETBOX_DEVICE_USERNAME"),
+		Password: os.Getenv("NETBOX_DEVICE_PASSWORD"),
+		Cert:     n.Name + ".pem",
+		Source:   sourceNetbox,
+	}
+	if n.PrimaryIP4 != nil {
+		// NetBox addresses have a prefix length
+		device.Ip = strings.SplitN(n.PrimaryIP4.Address, "/", 2)[0]
+	}
+	if port, ok := n.CustomFields["grpc_port"]; ok && port != nil {
+		device.Port = strings.TrimSuffix(fmt.Sprint(port), ".0")
+	}
+	if profile, ok := n.CustomFields["tviewer_profile"].(string); ok && profile != "" {
+		device.Profile = profile
+		device.Username = ""
+		device.Password = ""
+		// Without a certificate of its own the device uses the one of the profile
+		if _, err := os.Stat(filepath.Join(netboxCertDirectory(), device.Cert)); err != nil {
+			device.Cert = ""
+		}
+	}
+	for _, raw := range n.Tags {
+		var name string
+		if json.Unmarshal(raw, &name) != nil {
+			var tag struct {
+				Name string `json:"name"`
+				Slug string `json:"slug"`
+			}
+			json.Unmarshal(raw, &tag)
+			name = tag.Slug
+			if name == "" {
+				name = tag.Name
+			}
+		}
+		if name != "" {
+			device.Tags = append(device.Tags, name)
+		}
+	}
+	return device, nil
+}
+
+// fetchNetboxDevices reads every page of /api/dcim/devices/ that matches the
+// filter
+func fetchNetboxDevices() ([]netboxDevice, error) {
+	config := currentConfig()
+	base, err := url.Parse(config.NetboxURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid inventory URL: %v", err)
+	}
+	next := strings.TrimSuffix(config.NetboxURL, "/") + "/api/dcim/devices/?limit=" + fmt.Sprint(netboxPageSize)
+	if config.NetboxFilter != "" {
+		next += "&" + strings.TrimPrefix(config.NetboxFilter, "?")
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	var devices []netboxDevice
+	for next != "" {
+		req, err := http.NewRequest("GET", next, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		if token := os.Getenv("NETBOX_TOKEN"); token != "" {
+			req.Header.Set("Authorization", "Token " + token)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("cannot query inventory: %v", err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read inventory: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("inventory returned %v: %v", resp.Status, strings.TrimSpace(string(body)))
+		}
+
+		var page netboxPage
+		if err = json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("cannot decode inventory: %v", err)
+		}
+		devices = append(devices, page.Results...)
+
+		next = ""
+		if page.Next != nil {
+			// The token goes with every request, so pages are only read from
+			// the configured server
+			u, err := url.Parse(*page.Next)
+			if err != nil || u.Scheme != base.Scheme || u.Host != base.Host {
+				return nil, fmt.Errorf("inventory returned a next page on another server: %v", *page.Next)
+			}
+			next = *page.Next
+		}
+	}
+	return devices, nil
+}
@@ -0,0 +1,240 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"github.com/sfloresk/tviewer/model"
+)
+
+// setNetbox points the inventory sync to url with filter until the test ends
+func setNetbox(t *testing.T, url string, filter string) {
+	settingsMutex.Lock()
+	previous := settings
+	settings.NetboxURL, settings.NetboxFilter = url, filter
+	settingsMutex.Unlock()
+	t.Cleanup(func() {
+		settingsMutex.Lock()
+		settings = previous
+		settingsMutex.Unlock()
+	})
+}
+
+// netboxStandIn serves the devices in pages of pageSize, following the
+// offset of the query like NetBox does, and records the queries it gets
+func netboxStandIn(t *testing.T, devices []string, pageSize int) (*httptest.Server, *[]string) {
+	var queries []string
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/dcim/devices/" {
+			http.NotFound(w, r)
+			return
+		}
+		queries = append(queries, r.URL.RawQuery)
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+		page := map[string]interface{}{"next": nil}
+		end := offset + pageSize
+		if end < len(devices) {
+			page["next"] = server.URL + r.URL.Path + "?offset=" + strconv.Itoa(end)
+		} else {
+			end = len(devices)
+		}
+		var results []map[string]interface{}
+		for _, name := range devices[offset:end] {
+			results = append(results, map[string]interface{}{
+				"name":        name,
+				"primary_ip4": map[string]string{"address": "10.0.0.1/32"},
+			})
+		}
+		page["results"] = results
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(mustJSON(t, page))
+	}))
+	t.Cleanup(server.Close)
+	return server, &queries
+}
+
+func mustJSON(t *testing.T, v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestFetchNetboxDevicesFollowsPages(t *testing.T) {
+	server, queries := netboxStandIn(t, []string{"r1", "r2", "r3", "r4", "r5"}, 2)
+	setNetbox(t, server.URL, "")
+
+	devices, err := fetchNetboxDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, device := range devices {
+		names = append(names, device.Name)
+	}
+	if want := []string{"r1", "r2", "r3", "r4", "r5"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got devices %v, want %v", names, want)
+	}
+	if len(*queries) != 3 {
+		t.Errorf("got %d requests, want 3: %v", len(*queries), *queries)
+	}
+}
+
+func TestFetchNetboxDevicesOtherServer(t *testing.T) {
+	var token string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("Authorization")
+		w.Write([]byte(`{"next": null, "results": []}`))
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(mustJSON(t, map[string]interface{}{"next": other.URL + "/api/dcim/devices/?offset=1", "results": []interface{}{}}))
+	}))
+	defer server.Close()
+	setNetbox(t, server.URL, "")
+	t.Setenv("NETBOX_TOKEN", "secret")
+
+	if _, err := fetchNetboxDevices(); err == nil {
+		t.Error("got no error for a next page on another server")
+	}
+	if token != "" {
+		t.Errorf("sent Authorization %q to another server", token)
+	}
+}
+
+func TestFetchNetboxDevicesFilter(t *testing.T) {
+	for _, filter := range []string{"role=pe&site=lab", "?role=pe&site=lab"} {
+		server, queries := netboxStandIn(t, []string{"r1"}, 10)
+		setNetbox(t, server.URL + "/", filter)
+
+		if _, err := fetchNetboxDevices(); err != nil {
+			t.Fatal(err)
+		}
+		if want := "limit=100&role=pe&site=lab"; len(*queries) != 1 || (*queries)[0] != want {
+			t.Errorf("filter %q: got queries %v, want [%v]", filter, *queries, want)
+		}
+	}
+}
+
+func TestFetchNetboxDevicesToken(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Write([]byte(`{"next": null, "results": []}`))
+	}))
+	defer server.Close()
+	setNetbox(t, server.URL, "")
+	t.Setenv("NETBOX_TOKEN", "secret")
+
+	if _, err := fetchNetboxDevices(); err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "Token secret" {
+		t.Errorf("got Authorization %q, want %q", authorization, "Token secret")
+	}
+}
+
+func TestFetchNetboxDevicesError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Invalid token", http.StatusForbidden)
+	}))
+	defer server.Close()
+	setNetbox(t, server.URL, "")
+
+	_, err := fetchNetboxDevices()
+	if err == nil || !strings.Contains(err.Error(), "Invalid token") {
+		t.Errorf("got error %v, want the body of the 403", err)
+	}
+}
+
+func TestInventoryDevice(t *testing.T) {
+	var device netboxDevice
+	err := json.Unmarshal([]byte(`{
+		"name": "r1",
+		"primary_ip4": {"address": "10.0.0.1/24"},
+		"tags": ["core", {"name": "Lab Site", "slug": "lab-site"}, {"name": "pe"}],
+		"custom_fields": {"grpc_port": 57400}
+	}`), &device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := device.inventoryDevice()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Ip != "10.0.0.1" || got.Port != "57400" || got.Cert != "r1.pem" || got.Source != sourceNetbox {
+		t.Errorf("got %+v", got)
+	}
+	if want := []string{"core", "lab-site", "pe"}; !reflect.DeepEqual(got.Tags, want) {
+		t.Errorf("got tags %v, want %v", got.Tags, want)
+	}
+}
+
+func TestInventoryDeviceName(t *testing.T) {
+	for _, name := range []string{"../r1", "certs/r1", `certs\r1`, ".."} {
+		if _, err := (netboxDevice{Name: name}).inventoryDevice(); err == nil {
+			t.Errorf("name %q: got no error", name)
+		}
+	}
+}
+
+func TestPlanSyncDecommissionPending(t *testing.T) {
+	remote := []netboxDevice{{Name: "kept"}, {Name: "back"}}
+	current := []model.Device{
+		{Name: "kept", Source: sourceNetbox},
+		{Name: "back", Source: sourceNetbox, DecommissionPending: true},
+		{Name: "gone", Source: sourceNetbox},
+		{Name: "still-gone", Source: sourceNetbox, DecommissionPending: true},
+		// Added by hand, the inventory does not manage it
+		{Name: "manual"},
+	}
+
+	plan := planSync(remote, current)
+	if want := []string{"gone"}; !reflect.DeepEqual(plan.flag, want) {
+		t.Errorf("got flagged %v, want %v", plan.flag, want)
+	}
+	if want := []string{"back"}; !reflect.DeepEqual(plan.restore, want) {
+		t.Errorf("got restored %v, want %v", plan.restore, want)
+	}
+}
+
+func TestPlanSyncSkipsExisting(t *testing.T) {
+	remote := []netboxDevice{{Name: "synced"}, {Name: "manual"}, {Name: "new"}}
+	current := []model.Device{
+		{Name: "synced", Source: sourceNetbox},
+		{Name: "manual"},
+	}
+
+	plan := planSync(remote, current)
+	if len(plan.onboard.Devices) != 1 || plan.onboard.Devices[0].Name != "new" {
+		t.Errorf("got onboard %+v, want only new", plan.onboard.Devices)
+	}
+	if len(plan.flag) != 0 || len(plan.restore) != 0 || len(plan.rejected) != 0 {
+		t.Errorf("got flagged %v, restored %v and rejected %v, want none", plan.flag, plan.restore, plan.rejected)
+	}
+}
@@ -0,0 +1,299 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+	xr "github.com/nleiva/xrgrpc"
+	"github.com/sfloresk/tviewer/model"
+	"google.golang.org/grpc"
+)
+
+// Onboarding steps, in the order they run
+const (
+	stepValidate       = "cert_validated"
+	stepConnect        = "connected"
+	stepConfigureIF    = "interface_sensor_configured"
+	stepConfigureISIS  = "isis_sensor_configured"
+	stepFirstTelemetry = "first_telemetry_received"
+	stepPersist        = "stored"
+)
+
+// Step status reported while onboarding
+const (
+	stepPending    = "pending"
+	stepRunning    = "running"
+	stepDone       = "done"
+	stepFailed     = "failed"
+	stepRolledBack = "rolled_back"
+)
+
+// First request ID used to check the subscriptions, one per subscription
+const verifyRequestID int64 = 1100
+
+// onboardingStep is one stage of adding a device. If a later step fails, undo
+// is called for every step that completed, newest first.
+type onboardingStep struct {
+	name string
+	run  func() error
+	undo func()
+}
+
+// onboarding adds a device as a sequence of steps so a failure leaves nothing
+// behind: no device row blocking the name or IP, no certificate and no
+// telemetry config on the router
+type onboarding struct {
+	device model.Device
+	// User recorded in the audit log
+	actor  string
+	conn   *grpc.ClientConn
+	steps  []onboardingStep
+	// Index of the next step to run
+	next int
+	// Called with every step status change, can be nil
+	report func(step string, status string, err error)
+}
+
+func newOnboarding(device model.Device, actor string) *onboarding {
+	o := &onboarding{device: device, actor: actor}
+	o.steps = []onboardingStep{
+		{name: stepValidate, run: o.validate},
+		{name: stepConnect, run: o.connect, undo: o.disconnect},
+		{name: stepConfigureIF, run: o.configureInterfaces, undo: o.unconfigureInterfaces},
+		{name: stepConfigureISIS, run: o.configureISIS, undo: o.unconfigureISIS},
+		{name: stepFirstTelemetry, run: o.verify},
+		{name: stepPersist, run: o.persist},
+	}
+	return o
+}
+
+// onboardDevice validates the device, connects to it, pushes the telemetry
+// config, checks that the subscriptions stream and only then stores it. The
+// device is returned with the credentials of its profile.
+func onboardDevice(device model.Device, actor string) (model.Device, error) {
+	o := newOnboarding(device, actor)
+	err := jobs.reserve(device.Name, device.Ip)
+	if err == nil {
+		err = o.run()
+		jobs.release(device.Name, device.Ip)
+	}
+	o.audit(err)
+	return o.device, err
+}
+
+// audit records the outcome of the onboarding with the hash of the configs
+// pushed to the device
+func (o *onboarding) audit(err error) {
+	hash := ""
+	if configs, renderErr := renderTelemetryConfigs(o.device); renderErr == nil {
+		hash = configHash(configs...)
+	}
+	recordAudit(o.actor, auditDeviceCreate, o.device.Name, hash, err)
+}
+
+func (o *onboarding) stepNames() []string {
+	names := make([]string, len(o.steps))
+	for i, step := range o.steps {
+		names[i] = step.name
+	}
+	return names
+}
+
+func (o *onboarding) setStatus(step string, status string, err error) {
+	if o.report != nil {
+		o.report(step, status, err)
+	}
+}
+
+// run runs the remaining steps
+func (o *onboarding) run() error {
+	return o.runNext(len(o.steps) - o.next)
+}
+
+// runNext runs the next n steps. On failure every completed step is rolled
+// back.
+func (o *onboarding) runNext(n int) error {
+	for ; n > 0 && o.next < len(o.steps); n-- {
+		step := o.steps[o.next]
+		o.setStatus(step.name, stepRunning, nil)
+		err := step.run()
+		if err == nil {
+			o.setStatus(step.name, stepDone, nil)
+			o.next++
+			continue
+		}
+		log.Printf("Onboarding of %v failed at %v: %v", o.device.Name, step.name, err)
+		o.setStatus(step.name, stepFailed, err)
+
+		// Roll back what was done so far
+		for j := o.next - 1; j >= 0; j-- {
+			if o.steps[j].undo != nil {
+				o.steps[j].undo()
+				o.setStatus(o.steps[j].name, stepRolledBack, nil)
+			}
+		}
+		if kindOf(err) != errorInternal {
+			return err
+		}
+		return fmt.Errorf("onboarding failed at %v: %v", step.name, err)
+	}
+
+	if o.next == len(o.steps) {
+		o.conn.Close()
+	}
+	return nil
+}
+
+func (o *onboarding) validate() error {
+	device, err := resolveProfile(o.device)
+	if err != nil {
+		return err
+	}
+	o.device = device
+	// Whatever the client sent, the device gets the configured settings
+	ids := configuredTelemetryIDs()
+	o.device.Telemetry = &ids
+
+	if err := validateDevice(o.device); err != nil {
+		return err
+	}
+	if err := checkNewCertificates(o.device, model.Device{}); err != nil {
+		return err
+	}
+	if o.device.Certificate == "" {
+		return newServiceError(errorInvalid, "Certificate is required")
+	}
+	if o.device.ClientCertificate != "" && o.device.ClientKey == "" {
+		return newServiceError(errorInvalid, "Client key is required with a client certificate")
+	}
+	o.device = describeCertificates(o.device)
+
+	session, dbCollection, err := openDevicesCollection()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	return checkDeviceUnique(dbCollection, o.device)
+}
+
+// connect writes the certificate, which the connection needs, and connects
+func (o *onboarding) connect() error {
+	err := writeCertificate(o.device)
+	if err != nil {
+		return err
+	}
+
+	o.conn, err = connectDevice(o.device)
+	if err != nil {
+		os.Remove(certPath(o.device.Name))
+		return err
+	}
+	return nil
+}
+
+func (o *onboarding) disconnect() {
+	o.conn.Close()
+	os.Remove(certPath(o.device.Name))
+}
+
+func (o *onboarding) configureInterfaces() error {
+	return mergeTelemetryConfig(o.conn, o.device, ifTelemetryConfig, o.actor)
+}
+
+func (o *onboarding) unconfigureInterfaces() {
+	if err := deleteTelemetryConfig(o.conn, o.device, ifTelemetryConfig, o.actor); err != nil {
+		log.Printf("Cannot roll back interface telemetry config of %v: %v", o.device.Name, err)
+	}
+}
+
+func (o *onboarding) configureISIS() error {
+	return mergeTelemetryConfig(o.conn, o.device, isisTelemetryConfig, o.actor)
+}
+
+func (o *onboarding) unconfigureISIS() {
+	if err := deleteTelemetryConfig(o.conn, o.device, isisTelemetryConfig, o.actor); err != nil {
+		log.Printf("Cannot roll back ISIS telemetry config of %v: %v", o.device.Name, err)
+	}
+}
+
+// verify waits for the first message of each tviewer subscription
+func (o *onboarding) verify() error {
+	ids := deviceTelemetryIDs(o.device)
+	for i, subscriptionID := range []string{ids.InterfaceSubscriptionID, ids.ISISSubscriptionID} {
+		err := waitForTelemetry(o.conn, o.device, subscriptionID, verifyRequestID + int64(i))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *onboarding) persist() error {
+	session, dbCollection, err := openDevicesCollection()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	// Another request may have added the same name or IP meanwhile
+	if err = checkDeviceUnique(dbCollection, o.device); err != nil {
+		return err
+	}
+
+	stored, err := sealDevice(o.device)
+	if err != nil {
+		return err
+	}
+
+	// Insert new device in Database
+	if err = dbCollection.Insert(&stored); err != nil {
+		return fmt.Errorf("cannot insert in devices table: %v", err)
+	}
+	return nil
+}
+
+// waitForTelemetry opens the subscription and waits for its first message.
+// It gives the router a few sample intervals to start streaming, counted from
+// now rather than from the connection.
+func waitForTelemetry(conn *grpc.ClientConn, device model.Device, subscriptionID string, id int64) error {
+	timeout := time.Duration(3 * deviceSampleInterval(device)) * time.Millisecond + 10 * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// encoding GPB
+	var e int64 = 2
+
+	ch, ech, err := xr.GetSubscription(ctx, conn, subscriptionID, id, e)
+	if err != nil {
+		return fmt.Errorf("could not setup telemetry subscription %v: %v", subscriptionID, err)
+	}
+
+	select {
+	case <-ch:
+		return nil
+	case err = <-ech:
+		return fmt.Errorf("telemetry subscription %v failed: %v", subscriptionID, err)
+	case <-ctx.Done():
+		return fmt.Errorf("no telemetry received on subscription %v: %v", subscriptionID, ctx.Err())
+	}
+}
@@ -0,0 +1,102 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"net/http"
+	"github.com/gorilla/mux"
+	"github.com/sfloresk/tviewer/model"
+)
+
+type profiles struct {
+	telemetryChannel chan model.TelemetryWrapper
+}
+
+func (p profiles) registerRoutes(r *mux.Router) {
+	r.HandleFunc("/api/profiles", requireRole(roleAdmin, p.handleListProfiles)).Methods("GET")
+	r.HandleFunc("/api/profiles", requireRole(roleAdmin, p.handleCreateProfile)).Methods("POST")
+	r.HandleFunc("/api/profiles", handleMethodNotAllowed)
+	r.HandleFunc("/api/profiles/{name}", requireRole(roleAdmin, p.handleGetProfile)).Methods("GET")
+	r.HandleFunc("/api/profiles/{name}", requireRole(roleAdmin, p.handleReplaceProfile)).Methods("PUT")
+	r.HandleFunc("/api/profiles/{name}", requireRole(roleAdmin, p.handleDeleteProfile)).Methods("DELETE")
+	r.HandleFunc("/api/profiles/{name}", handleMethodNotAllowed)
+}
+
+func (p profiles) handleListProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles, err := listProfiles()
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	result := make([]model.CredentialProfile, len(profiles))
+	for i, profile := range profiles {
+		result[i] = redactProfile(profile)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (p profiles) handleCreateProfile(w http.ResponseWriter, r *http.Request) {
+	var profile model.CredentialProfile
+	if !decodeJSONBody(w, r, &profile) {
+		return
+	}
+	if err := addProfile(profile, requestUser(r).Name); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/api/profiles/" + profile.Name)
+	writeJSON(w, http.StatusCreated, redactProfile(profile))
+}
+
+func (p profiles) handleGetProfile(w http.ResponseWriter, r *http.Request) {
+	profile, err := getProfile(mux.Vars(r)["name"])
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, redactProfile(profile))
+}
+
+// handleReplaceProfile rotates the profile, returning the devices whose
+// collectors were restarted with the new credentials
+func (p profiles) handleReplaceProfile(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	var profile model.CredentialProfile
+	if !decodeJSONBody(w, r, &profile) {
+		return
+	}
+	rotated, err := updateProfile(name, profile, p.telemetryChannel, requestUser(r).Name)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	profile, err = getProfile(name)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"profile": redactProfile(profile), "rotatedDevices": rotated})
+}
+
+func (p profiles) handleDeleteProfile(w http.ResponseWriter, r *http.Request) {
+	if err := deleteProfile(mux.Vars(r)["name"], requestUser(r).Name); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
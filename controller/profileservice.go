@@ -0,0 +1,281 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"fmt"
+	"log"
+	"github.com/sfloresk/tviewer/model"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Credential profile operations shared by the API layers
+
+func validateProfile(profile model.CredentialProfile) error {
+	if profile.Name == "" {
+		return newServiceError(errorInvalid, "Name is required")
+	}
+	if !deviceNamePattern.MatchString(profile.Name) {
+		return newServiceError(errorInvalid, "Name %v can only contain letters, digits, '.', '_' and '-'", profile.Name)
+	}
+	if profile.Certificate != "" {
+		if err := validateCertificate(profile.Certificate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func openProfilesCollection() (*mgo.Session, *mgo.Collection, error) {
+	session, _, err := openDevicesCollection()
+	if err != nil {
+		return nil, nil, err
+	}
+	return session, session.DB(currentConfig().DatabaseName).C("Profiles"), nil
+}
+
+func listProfiles() ([]model.CredentialProfile, error) {
+	session, dbCollection, err := openProfilesCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	profiles := make([]model.CredentialProfile, 0)
+	err = dbCollection.Find(nil).All(&profiles)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read profiles table: %v", err)
+	}
+	for i := range profiles {
+		if profiles[i], err = openProfile(profiles[i]); err != nil {
+			return nil, err
+		}
+	}
+	return profiles, nil
+}
+
+func getProfile(name string) (model.CredentialProfile, error) {
+	var profile model.CredentialProfile
+
+	session, dbCollection, err := openProfilesCollection()
+	if err != nil {
+		return profile, err
+	}
+	defer session.Close()
+
+	err = dbCollection.Find(bson.M{"name": name}).One(&profile)
+	if err == mgo.ErrNotFound {
+		return profile, newServiceError(errorNotFound, "Profile %v not found", name)
+	}
+	if err != nil {
+		return profile, fmt.Errorf("cannot read profiles table: %v", err)
+	}
+	return openProfile(profile)
+}
+
+func addProfile(profile model.CredentialProfile, actor string) (err error) {
+	defer func() {
+		recordAudit(actor, auditProfileCreate, profile.Name, "", err)
+	}()
+
+	if err := validateProfile(profile); err != nil {
+		return err
+	}
+	if profile.Certificate != "" {
+		if err := checkNotExpired(profile.Certificate, "Certificate"); err != nil {
+			return err
+		}
+	}
+
+	session, dbCollection, err := openProfilesCollection()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	count, err := dbCollection.Find(bson.M{"name": profile.Name}).Count()
+	if err != nil {
+		return fmt.Errorf("cannot read profiles table: %v", err)
+	}
+	if (count > 0) {
+		return newServiceError(errorConflict, "Profile %v already exists", profile.Name)
+	}
+
+	stored, err := sealProfile(profile)
+	if err != nil {
+		return err
+	}
+	if err = dbCollection.Insert(&stored); err != nil {
+		return fmt.Errorf("cannot insert in profiles table: %v", err)
+	}
+	return nil
+}
+
+// resolveProfile fills the credentials of a device that references a
+// profile. Fields set in the profile win over those of the device.
+func resolveProfile(device model.Device) (model.Device, error) {
+	if device.Profile == "" {
+		return device, nil
+	}
+	profile, err := getProfile(device.Profile)
+	if kindOf(err) == errorNotFound {
+		return device, newServiceError(errorInvalid, "Profile %v not found", device.Profile)
+	}
+	if err != nil {
+		return device, err
+	}
+	return applyProfile(device, profile), nil
+}
+
+func applyProfile(device model.Device, profile model.CredentialProfile) model.Device {
+	if profile.Username != "" {
+		device.Username = profile.Username
+	}
+	if profile.Password != "" {
+		device.Password = profile.Password
+	}
+	if profile.Certificate != "" {
+		device.Certificate = profile.Certificate
+	}
+	return device
+}
+
+// updateProfile replaces the profile and rotates the credentials of every
+// device that uses it: each device is updated and its collectors restarted.
+// The names of those devices are returned. Profiles cannot be renamed.
+func updateProfile(name string, profile model.CredentialProfile, telemetryChannel chan model.TelemetryWrapper, actor string) (rotated []string, err error) {
+	defer func() {
+		recordAudit(actor, auditProfileUpdate, name, "", err)
+	}()
+
+	if profile.Name == "" {
+		profile.Name = name
+	}
+	if profile.Name != name {
+		return nil, newServiceError(errorInvalid, "Profile %v cannot be renamed to %v", name, profile.Name)
+	}
+	if err := validateProfile(profile); err != nil {
+		return nil, err
+	}
+	current, err := getProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	// Devices keep their own value of the fields the profile does not set,
+	// so clearing one would leave them with the old credentials
+	if profile.Username == "" && current.Username != "" {
+		return nil, newServiceError(errorInvalid, "Username of profile %v cannot be cleared", name)
+	}
+	if profile.Certificate == "" && current.Certificate != "" {
+		return nil, newServiceError(errorInvalid, "Certificate of profile %v cannot be cleared", name)
+	}
+	// The stored certificate is kept even if it expired
+	if profile.Certificate != "" && profile.Certificate != current.Certificate {
+		if err := checkNotExpired(profile.Certificate, "Certificate"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Secrets are write-only, an empty password keeps the current one
+	if profile.Password == "" {
+		profile.Password = current.Password
+	}
+
+	session, dbCollection, err := openProfilesCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	stored, err := sealProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	err = dbCollection.Update(bson.M{"name": name}, &stored)
+	if err == mgo.ErrNotFound {
+		return nil, newServiceError(errorNotFound, "Profile %v not found", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot update profiles table: %v", err)
+	}
+
+	var devices []model.Device
+	devicesCollection := session.DB(currentConfig().DatabaseName).C("Devices")
+	err = devicesCollection.Find(bson.M{"profile": name}).All(&devices)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read devices table: %v", err)
+	}
+
+	rotated = make([]string, 0, len(devices))
+	for _, current := range devices {
+		if current, err = openDevice(current); err != nil {
+			return rotated, err
+		}
+		device := describeCertificates(applyProfile(current, profile))
+		if !connectionChanged(current, device) {
+			continue
+		}
+		stored, err := sealDevice(device)
+		if err != nil {
+			return rotated, err
+		}
+		err = devicesCollection.Update(bson.M{"name": device.Name}, &stored)
+		if err != nil {
+			return rotated, fmt.Errorf("cannot update device %v: %v", device.Name, err)
+		}
+		if err = writeCertificate(device); err != nil {
+			return rotated, fmt.Errorf("device %v: %v", device.Name, err)
+		}
+		collectors.start(device, telemetryChannel)
+		log.Printf("Rotated credentials of %v from profile %v", device.Name, name)
+		recordAudit(actor, auditDeviceCredentials, device.Name, "", nil)
+		rotated = append(rotated, device.Name)
+	}
+	return rotated, nil
+}
+
+// deleteProfile removes a profile that no device uses
+func deleteProfile(name string, actor string) (err error) {
+	defer func() {
+		recordAudit(actor, auditProfileDelete, name, "", err)
+	}()
+
+	session, dbCollection, err := openProfilesCollection()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	count, err := session.DB(currentConfig().DatabaseName).C("Devices").Find(bson.M{"profile": name}).Count()
+	if err != nil {
+		return fmt.Errorf("cannot read devices table: %v", err)
+	}
+	if (count > 0) {
+		return newServiceError(errorConflict, "Profile %v is used by %v device(s)", name, count)
+	}
+
+	err = dbCollection.Remove(bson.M{"name": name})
+	if err == mgo.ErrNotFound {
+		return newServiceError(errorNotFound, "Profile %v not found", name)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot delete data in profiles table: %v", err)
+	}
+	return nil
+}
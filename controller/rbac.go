@@ -0,0 +1,73 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"log"
+	"net/http"
+	"github.com/sfloresk/tviewer/model"
+)
+
+// Roles, each one can do everything the previous one can
+const (
+	// Sees the topology
+	roleViewer = "viewer"
+	// Sees the devices, restarts collectors and annotates the topology
+	roleOperator = "operator"
+	// Onboards, changes and decommissions devices, pushes config and
+	// manages profiles and users
+	roleAdmin = "admin"
+)
+
+const codeForbidden = "forbidden"
+
+var roleRanks = map[string]int{
+	roleViewer:   1,
+	roleOperator: 2,
+	roleAdmin:    3,
+}
+
+func validRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// hasRole tells whether the user has the role or a higher one
+func hasRole(user model.User, role string) bool {
+	return roleRanks[user.Role] >= roleRanks[role]
+}
+
+// allowed checks the role of the user for the action, logging denials
+func allowed(user model.User, role string, action string) bool {
+	if hasRole(user, role) {
+		return true
+	}
+	log.Printf("Denied %v to user %v with role %v, requires %v", action, user.Name, user.Role, role)
+	return false
+}
+
+// requireRole wraps the handler of a route so only users with the role reach it
+func requireRole(role string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowed(requestUser(r), role, r.Method + " " + r.URL.Path) {
+			writeAPIError(w, http.StatusForbidden, codeForbidden, "Role " + role + " required")
+			return
+		}
+		handler(w, r)
+	}
+}
@@ -0,0 +1,271 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"github.com/sfloresk/tviewer/model"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Secrets (passwords) are stored encrypted with AES-256-GCM under a master
+// key from TVIEWER_MASTER_KEY or the file named by TVIEWER_MASTER_KEY_FILE,
+// base64 encoded in both cases. Stored values carry a version prefix, but
+// only the sealed field of the device or profile tells that they are
+// encrypted: a secret given by a user may start with the prefix too.
+const secretPrefix = "enc:v1:"
+
+var masterKey []byte
+
+// loadMasterKey reads the master key, which must be 32 bytes long
+func loadMasterKey() error {
+	encoded := os.Getenv("TVIEWER_MASTER_KEY")
+	if path := os.Getenv("TVIEWER_MASTER_KEY_FILE"); encoded == "" && path != "" {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("cannot read master key file: %v", err)
+		}
+		encoded = string(raw)
+	}
+	if encoded == "" {
+		return errors.New("no master key, set TVIEWER_MASTER_KEY or TVIEWER_MASTER_KEY_FILE to 32 base64 encoded bytes, e.g. from: head -c 32 /dev/urandom | base64")
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return fmt.Errorf("master key is not base64: %v", err)
+	}
+	if len(key) != 32 {
+		return fmt.Errorf("master key must be 32 bytes long, not %v", len(key))
+	}
+	masterKey = key
+	return nil
+}
+
+func secretCipher() (cipher.AEAD, error) {
+	if masterKey == nil {
+		return nil, errors.New("master key not loaded")
+	}
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSecret returns the stored form of a secret. Empty values are
+// returned as they are.
+func encryptSecret(plain string) (string, error) {
+	if plain == "" {
+		return plain, nil
+	}
+	aead, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret reverses encryptSecret
+func decryptSecret(stored string) (string, error) {
+	if stored == "" {
+		return stored, nil
+	}
+	aead, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	sealed, ok := decodeSecret(aead, stored)
+	if !ok {
+		return "", errors.New("malformed encrypted secret")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("cannot decrypt secret, wrong master key?")
+	}
+	return string(plain), nil
+}
+
+// decodeSecret returns the nonce and ciphertext of a stored secret, and
+// whether it has the form encryptSecret gives
+func decodeSecret(aead cipher.AEAD, stored string) ([]byte, bool) {
+	if !strings.HasPrefix(stored, secretPrefix) {
+		return nil, false
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, secretPrefix))
+	if err != nil || len(sealed) < aead.NonceSize() + aead.Overhead() {
+		return nil, false
+	}
+	return sealed, true
+}
+
+// sealDevice returns the device as it is stored. Its secrets must be in the
+// clear.
+func sealDevice(device model.Device) (model.Device, error) {
+	password, err := encryptSecret(device.Password)
+	if err != nil {
+		return device, err
+	}
+	device.Password = password
+	clientKey, err := encryptSecret(device.ClientKey)
+	device.ClientKey = clientKey
+	device.Sealed = true
+	return device, err
+}
+
+// openDevice returns a stored device with its secrets in the clear. Devices
+// that are not sealed yet are returned as they are.
+func openDevice(device model.Device) (model.Device, error) {
+	if !device.Sealed {
+		return device, nil
+	}
+	password, err := decryptSecret(device.Password)
+	if err != nil {
+		return device, fmt.Errorf("device %v: %v", device.Name, err)
+	}
+	device.Password = password
+	clientKey, err := decryptSecret(device.ClientKey)
+	if err != nil {
+		return device, fmt.Errorf("device %v: %v", device.Name, err)
+	}
+	device.ClientKey = clientKey
+	device.Sealed = false
+	return device, nil
+}
+
+func sealProfile(profile model.CredentialProfile) (model.CredentialProfile, error) {
+	password, err := encryptSecret(profile.Password)
+	profile.Password = password
+	profile.Sealed = true
+	return profile, err
+}
+
+func openProfile(profile model.CredentialProfile) (model.CredentialProfile, error) {
+	if !profile.Sealed {
+		return profile, nil
+	}
+	password, err := decryptSecret(profile.Password)
+	if err != nil {
+		return profile, fmt.Errorf("profile %v: %v", profile.Name, err)
+	}
+	profile.Password = password
+	profile.Sealed = false
+	return profile, nil
+}
+
+// redactDevice removes the write-only secrets before a device is returned and
+// flags certificates that expire soon
+func redactDevice(device model.Device) model.Device {
+	device.Password = ""
+	device.ClientKey = ""
+	device.CertificateExpiring = certificateExpiring(device)
+	return device
+}
+
+func redactDevices(devices []model.Device) []model.Device {
+	result := make([]model.Device, len(devices))
+	for i, device := range devices {
+		result[i] = redactDevice(device)
+	}
+	return result
+}
+
+func redactProfile(profile model.CredentialProfile) model.CredentialProfile {
+	profile.Password = ""
+	return profile
+}
+
+// migrateSecret returns the sealed form of a secret of owner stored without
+// the sealed field. Older versions stored secrets in the clear, and later
+// ones encrypted them without setting the field, so values that decrypt with
+// the master key are kept and anything else is taken as cleartext, even if
+// it has the form of an encrypted secret.
+func migrateSecret(stored string, owner string) (string, error) {
+	aead, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	if _, ok := decodeSecret(aead, stored); ok {
+		if _, err := decryptSecret(stored); err == nil {
+			return stored, nil
+		}
+		log.Printf("A secret of %v looks encrypted but does not decrypt with the master key, sealing it as cleartext", owner)
+	}
+	return encryptSecret(stored)
+}
+
+// migrateSecrets seals the devices and profiles stored by older versions
+func migrateSecrets() error {
+	session, dbCollection, err := openDevicesCollection()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	var devices []model.Device
+	err = dbCollection.Find(bson.M{"sealed": bson.M{"$ne": true}}).All(&devices)
+	if err != nil {
+		return fmt.Errorf("cannot read devices table: %v", err)
+	}
+	for _, device := range devices {
+		password, err := migrateSecret(device.Password, "device " + device.Name)
+		if err != nil {
+			return fmt.Errorf("device %v: %v", device.Name, err)
+		}
+		clientKey, err := migrateSecret(device.ClientKey, "device " + device.Name)
+		if err != nil {
+			return fmt.Errorf("device %v: %v", device.Name, err)
+		}
+		err = dbCollection.Update(bson.M{"name": device.Name}, bson.M{"$set": bson.M{"password": password, "clientkey": clientKey, "sealed": true}})
+		if err != nil {
+			return fmt.Errorf("cannot update device table: %v", err)
+		}
+	}
+
+	var profiles []model.CredentialProfile
+	profilesCollection := session.DB(currentConfig().DatabaseName).C("Profiles")
+	err = profilesCollection.Find(bson.M{"sealed": bson.M{"$ne": true}}).All(&profiles)
+	if err != nil {
+		return fmt.Errorf("cannot read profiles table: %v", err)
+	}
+	for _, profile := range profiles {
+		password, err := migrateSecret(profile.Password, "profile " + profile.Name)
+		if err != nil {
+			return fmt.Errorf("profile %v: %v", profile.Name, err)
+		}
+		err = profilesCollection.Update(bson.M{"name": profile.Name}, bson.M{"$set": bson.M{"password": password, "sealed": true}})
+		if err != nil {
+			return fmt.Errorf("cannot update profiles table: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+	"gopkg.in/mgo.v2"
+)
+
+// Closed when Shutdown starts. SSE and gRPC streams end on it and no new
+// collectors are started.
+var shuttingDown = make(chan struct{})
+
+// Open websocket connections, done once their close frame is written
+var websockets sync.WaitGroup
+
+// Shutdown stops tviewer in order: drains the HTTP and gRPC servers, closes
+// the websockets with a close frame, cancels the collectors and flushes the
+// database. Steps that do not finish before ctx is done are abandoned.
+func Shutdown(ctx context.Context) {
+	close(shuttingDown)
+
+	log.Println("Shutting down: draining HTTP and gRPC requests")
+	webServersMutex.Lock()
+	for _, server := range webServers {
+		err := server.Shutdown(ctx)
+		if err != nil {
+			log.Printf("Web server %v did not drain: %v", server.Addr, err)
+		}
+	}
+	webServersMutex.Unlock()
+	grpcAPIServerMutex.Lock()
+	if grpcAPIServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcAPIServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcAPIServer.Stop()
+		}
+	}
+	grpcAPIServerMutex.Unlock()
+
+	log.Println("Shutting down: closing websockets")
+	topologyController.hub.disconnectAll()
+	jobs.closeWatchers()
+	waitFor(ctx, &websockets, "websockets")
+
+	log.Println("Shutting down: stopping collectors")
+	collectors.stopAll()
+	waitFor(ctx, &collectors.active, "collectors")
+
+	log.Println("Shutting down: flushing the database")
+	flushStorage(ctx)
+}
+
+// waitFor waits for the group, or until ctx is done
+func waitFor(ctx context.Context, group *sync.WaitGroup, what string) {
+	done := make(chan struct{})
+	go func() {
+		group.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Not waiting any longer for %v: %v", what, ctx.Err())
+	}
+}
+
+// flushStorage asks MongoDB to write everything to disk. Collectors close
+// their own sessions when they stop.
+func flushStorage(ctx context.Context) {
+	timeout := 10 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	session, err := mgo.DialWithTimeout(currentConfig().Database, timeout)
+	if err != nil {
+		log.Printf("Cannot open database: %v", err)
+		return
+	}
+	defer session.Close()
+	err = session.Fsync(false)
+	if err != nil {
+		log.Printf("Cannot flush the database: %v", err)
+	}
+}
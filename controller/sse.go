@@ -0,0 +1,98 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// Comment lines sent while idle so proxies keep the stream open
+	sseKeepAlivePeriod = 30 * time.Second
+	// Reconnection delay suggested to EventSource clients, in milliseconds
+	sseRetry = 3000
+)
+
+// handleSSE streams the same snapshots and patches as /ws/topology as
+// server-sent events. The event id is the topology version, so a client that
+// reconnects with Last-Event-ID gets only what changed since then. Filters
+// are taken from the query string (see filterFromQuery).
+func (t topology) handleSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	filter, err := filterFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client := newHubClient(r.RemoteAddr, r.URL.Query().Get("mode") == "full")
+	client.filter = filter
+	client.lastID = r.Header.Get("Last-Event-ID")
+	if client.lastID == "" {
+		// EventSource polyfills that cannot set headers send it in the query
+		client.lastID = r.URL.Query().Get("lastEventId")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry)
+	flusher.Flush()
+
+	t.hub.register <- client
+	defer func() {
+		t.hub.unregister <- client
+	}()
+
+	ticker := time.NewTicker(sseKeepAlivePeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case message, ok := <-client.send:
+			if !ok {
+				// Evicted by the hub
+				return
+			}
+			if message.ID != "" {
+				fmt.Fprintf(w, "id: %s\n", message.ID)
+			}
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", message.Type, message.Data)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			if _, err = fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-shuttingDown:
+			return
+		}
+	}
+}
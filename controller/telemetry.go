@@ -22,8 +22,6 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"os"
-	"os/signal"
 	"github.com/golang/protobuf/proto"
 	xr "github.com/nleiva/xrgrpc"
 	"github.com/sfloresk/tviewer/proto/telemetry"
@@ -32,6 +30,7 @@ import (
 	"github.com/sfloresk/tviewer/model"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"reflect"
 	"time"
 )
 
@@ -42,11 +41,20 @@ type Node struct {
 	Password string
 	CertName string
 	Port     string
+	// Client certificate and key for mutual TLS, if any
+	ClientCertificate string
+	ClientKey         string
+	// Incremented each time the collectors of a device start
+	Generation uint64
+	// Telemetry settings pushed to the device
+	Telemetry model.TelemetryIDs
 }
 
-func (node Node) CollectInterfaceData(interfaceChannel chan model.TelemetryWrapper) {
+// CollectInterfaceData streams interface telemetry from the node until ctx is
+// cancelled or the session fails
+func (node Node) CollectInterfaceData(ctx context.Context, interfaceChannel chan model.TelemetryWrapper) {
 	// Open database
-	session, err := mgo.Dial(os.Getenv("TELEMETRY_DB"))
+	session, err := mgo.Dial(currentConfig().Database)
 	if err != nil {
 		panic(err)
 	}
@@ -55,10 +63,7 @@ func (node Node) CollectInterfaceData(interfaceChannel chan model.TelemetryWrapp
 	// Switch the session to a monotonic behavior.
 	session.SetMode(mgo.Monotonic, true)
 
-	dbCollection := session.DB("Telemetry").C("Interfaces")
-
-	// Clean database from previous data
-	err = dbCollection.Remove(bson.M{})
+	dbCollection := session.DB(currentConfig().DatabaseName).C("Interfaces")
 
 	// Variable for output formatting
 
@@ -67,76 +72,80 @@ func (node Node) CollectInterfaceData(interfaceChannel chan model.TelemetryWrapp
 	// Determine the ID for first the transaction.
 	var id int64 = 1000
 
-	// Manually specify target parameters.
-	router1, err := xr.BuildRouter(
-		xr.WithUsername(node.Username),
-		xr.WithPassword(node.Password),
-		xr.WithHost(node.Ip + ":" + node.Port),
-		xr.WithCert(node.CertName),
-		xr.WithTimeout(10000),
-	)
-	if err != nil {
-		log.Fatalf("target parameters for router are incorrect: %s", err)
-	}
-
 	// Connect to the target
-	conn1, ctx1, err := xr.Connect(*router1)
+	host := node.Ip + ":" + node.Port
+	conn1, ctx1, err := dialRouter(host, node.Username, node.Password, node.CertName, node.ClientCertificate, node.ClientKey, 10000)
 	if err != nil {
-		log.Fatalf("could not setup a client connection to %s, %v", router1.Host, err)
+		log.Printf("could not setup a client connection to %s, %v", host, err)
+		return
 	}
 	defer conn1.Close()
 
 	id++
 	ctx1, cancel := context.WithCancel(ctx1)
 	defer cancel()
-	c := make(chan os.Signal, 1)
-	// If no signals are provided, all incoming signals will be relayed to c.
-	// Otherwise, just the provided signals will. E.g.: signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	signal.Notify(c, os.Interrupt)
-	defer func() {
-		signal.Stop(c)
-		cancel()
-	}()
 
 	// encoding GPB
 	var e int64 = 2
 
-	ch, ech, err := xr.GetSubscription(ctx1, conn1, ifSubscriptionID, id, e)
+	subscriptionID := node.Telemetry.InterfaceSubscriptionID
+	ch, ech, err := xr.GetSubscription(ctx1, conn1, subscriptionID, id, e)
 
 	if err != nil {
-		log.Fatalf("could not setup Telemetry Subscription: %v\n", err)
+		log.Printf("could not setup Telemetry Subscription to %v: %v\n", host, err)
+		return
 	}
 
 	go func() {
 		select {
-		case <-c:
-			fmt.Printf("\nmanually cancelled the session to %v\n\n", router1.Host)
+		case <-ctx.Done():
+			// Collectors stopped, e.g. the device was updated or tviewer
+			// is shutting down
 			cancel()
 			return
 		case <-ctx1.Done():
 		// Timeout: "context deadline exceeded"
 			err = ctx1.Err()
-			fmt.Printf("\ngRPC session timed out after %v seconds: %v\n\n", router1.Timeout, err.Error())
+			fmt.Printf("\ngRPC session timed out after %v seconds: %v\n\n", 10000, err.Error())
 			return
 		case err = <-ech:
 		// Session canceled: "context canceled"
-			fmt.Printf("\ngRPC session to %v failed: %v\n\n", router1.Host, err.Error())
+			fmt.Printf("\ngRPC session to %v failed: %v\n\n", host, err.Error())
 			return
 		}
 	}()
 
+	// Exported until the stream ends
+	defer networkMetrics.removeInterfaces(node.Name, node.Generation)
+
+	// Streaming once the first message arrives, for the readiness check
+	streaming := false
+	defer func() {
+		if streaming {
+			collectors.streamEnded()
+		}
+	}()
+
 	for tele := range ch {
+		metricTelemetryMessages.WithLabelValues(subscriptionID).Inc()
+		if !streaming {
+			streaming = true
+			collectors.streamStarted()
+		}
 		result := make([]model.TelemetryMessage, 0)
 		message := new(telemetry.Telemetry)
 
 		var previousTs uint64 = 0
 		err := proto.Unmarshal(tele, message)
 		if err != nil {
-			log.Fatalf("Could not unmarshall the interface telemetry message for %v: %v\n", node.Name, err)
+			metricDecodeErrors.WithLabelValues(subscriptionID).Inc()
+			log.Printf("Could not unmarshall the interface telemetry message for %v: %v\n", node.Name, err)
+			continue
 		}
 
 		ts := message.GetMsgTimestamp()
 		changed := false
+		interfaceSamples := make([]interfaceSample, 0)
 
 		for _, row := range message.GetDataGpb().GetRow() {
 			// Get the message content
@@ -148,9 +157,14 @@ func (node Node) CollectInterfaceData(interfaceChannel chan model.TelemetryWrapp
 			err = proto.Unmarshal(content, ifaceInt)
 
 			if err != nil {
-				log.Fatalf("Could not decode content in the interface telemetry message for %v: %v\n", node.Name, err)
+				metricDecodeErrors.WithLabelValues(subscriptionID).Inc()
+				log.Printf("Could not decode content in the interface telemetry message for %v: %v\n", node.Name, err)
+				continue
 			}
 
+			// Every interface is exported, with or without an IP
+			interfaceSamples = append(interfaceSamples, newInterfaceSample(ts, ifaceInt))
+
 			// Get interface name and IP
 			ifName := ifaceInt.GetPerInterface()
 			ifaceIntIp := ifaceInt.GetPrimaryIpv4Address()
@@ -211,6 +225,8 @@ func (node Node) CollectInterfaceData(interfaceChannel chan model.TelemetryWrapp
 		}
 
 
+		networkMetrics.setInterfaces(node.Name, node.Generation, interfaceSamples)
+
 		// Search for old saved messages
 		count, err := dbCollection.Find(bson.M{"timestamp": previousTs}).Count()
 
@@ -233,9 +249,11 @@ func (node Node) CollectInterfaceData(interfaceChannel chan model.TelemetryWrapp
 	}
 }
 
-func (node Node) CollectISISData(isisChannel chan model.TelemetryWrapper) {
+// CollectISISData streams ISIS neighbour telemetry from the node until ctx is
+// cancelled or the session fails
+func (node Node) CollectISISData(ctx context.Context, isisChannel chan model.TelemetryWrapper) {
 	// Open database
-	session, err := mgo.Dial(os.Getenv("TELEMETRY_DB"))
+	session, err := mgo.Dial(currentConfig().Database)
 
 	if err != nil {
 		panic(err)
@@ -245,86 +263,87 @@ func (node Node) CollectISISData(isisChannel chan model.TelemetryWrapper) {
 	// Switch the session to a monotonic behavior.
 	session.SetMode(mgo.Monotonic, true)
 
-	dbCollection := session.DB("Telemetry").C("ISIS")
+	dbCollection := session.DB(currentConfig().DatabaseName).C("ISIS")
 
-	// Clean database from previous data
-	err = dbCollection.Remove(bson.M{})
 	// Variable for output formatting
 	flag.Parse()
 
 	// Determine the ID for first the transaction.
 	var id int64 = 1001
 
-	// Manually specify target parameters.
-	router1, err := xr.BuildRouter(
-		xr.WithUsername(node.Username),
-		xr.WithPassword(node.Password),
-		xr.WithHost(node.Ip + ":" + node.Port),
-		xr.WithCert(node.CertName),
-		xr.WithTimeout(10000),
-	)
-	if err != nil {
-		log.Fatalf("target parameters for router are incorrect: %s", err)
-	}
-
 	// Connect to the target
-	conn1, ctx1, err := xr.Connect(*router1)
+	host := node.Ip + ":" + node.Port
+	conn1, ctx1, err := dialRouter(host, node.Username, node.Password, node.CertName, node.ClientCertificate, node.ClientKey, 10000)
 	if err != nil {
-		log.Fatalf("could not setup a client connection to %s, %v", router1.Host, err)
+		log.Printf("could not setup a client connection to %s, %v", host, err)
+		return
 	}
 	defer conn1.Close()
 
 	id++
 	ctx1, cancel := context.WithCancel(ctx1)
 	defer cancel()
-	c := make(chan os.Signal, 1)
-
-	// If no signals are provided, all incoming signals will be relayed to c.
-	// Otherwise, just the provided signals will. E.g.: signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	signal.Notify(c, os.Interrupt)
-	defer func() {
-		signal.Stop(c)
-		cancel()
-	}()
 
 	// encoding GPB
 	var e int64 = 2
 
-	ch, ech, err := xr.GetSubscription(ctx1, conn1, isisSubscriptionID, id, e)
+	subscriptionID := node.Telemetry.ISISSubscriptionID
+	ch, ech, err := xr.GetSubscription(ctx1, conn1, subscriptionID, id, e)
 
 	if err != nil {
-		log.Fatalf("could not setup Telemetry Subscription: %v\n", err)
+		log.Printf("could not setup Telemetry Subscription to %v: %v\n", host, err)
+		return
 	}
 
 	go func() {
 		select {
-		case <-c:
-			fmt.Printf("\nmanually cancelled the session to %v\n\n", router1.Host)
+		case <-ctx.Done():
+			// Collectors stopped, e.g. the device was updated or tviewer
+			// is shutting down
 			cancel()
 			return
 		case <-ctx1.Done():
 		// Timeout: "context deadline exceeded"
 			err = ctx1.Err()
-			fmt.Printf("\ngRPC session timed out after %v seconds: %v\n\n", router1.Timeout, err.Error())
+			fmt.Printf("\ngRPC session timed out after %v seconds: %v\n\n", 10000, err.Error())
 			return
 		case err = <-ech:
 		// Session canceled: "context canceled"
-			fmt.Printf("\ngRPC session to %v failed: %v\n\n", router1.Host, err.Error())
+			fmt.Printf("\ngRPC session to %v failed: %v\n\n", host, err.Error())
 			return
 		}
 	}()
 
+	// Exported until the stream ends
+	defer networkMetrics.removeAdjacencies(node.Name, node.Generation)
+
+	// Streaming once the first message arrives, for the readiness check
+	streaming := false
+	defer func() {
+		if streaming {
+			collectors.streamEnded()
+		}
+	}()
+
 	for tele := range ch {
+		metricTelemetryMessages.WithLabelValues(subscriptionID).Inc()
+		if !streaming {
+			streaming = true
+			collectors.streamStarted()
+		}
 		result := make([]model.TelemetryMessage, 0)
 		message := new(telemetry.Telemetry)
 		var previousTs uint64 = 0
 
 		err := proto.Unmarshal(tele, message)
 		if err != nil {
-			log.Fatalf("could not unmarshall the message: %v\n", err)
+			metricDecodeErrors.WithLabelValues(subscriptionID).Inc()
+			log.Printf("could not unmarshall the ISIS telemetry message for %v: %v\n", node.Name, err)
+			continue
 		}
 		ts := message.GetMsgTimestamp()
 		changed := false
+		adjacencySamples := make([]adjacencySample, 0)
 
 		for _, row := range message.GetDataGpb().GetRow() {
 			// Get message content
@@ -334,8 +353,11 @@ func (node Node) CollectISISData(isisChannel chan model.TelemetryWrapper) {
 			nbr := new(isis.IsisShNbr)
 			err = proto.Unmarshal(content, nbr)
 			if err != nil {
-				log.Fatalf("could decode Content: %v\n", err)
+				metricDecodeErrors.WithLabelValues(subscriptionID).Inc()
+				log.Printf("could not decode content in the ISIS telemetry message for %v: %v\n", node.Name, err)
+				continue
 			}
+			adjacencySamples = append(adjacencySamples, newAdjacencySample(nbr))
 
 			// Get local interface
 			lif := nbr.GetLocalInterface()
@@ -346,12 +368,19 @@ func (node Node) CollectISISData(isisChannel chan model.TelemetryWrapper) {
 					ngrAddrsBytes := nbr.GetNeighborPerAddressFamilyData()[0].GetIpv4().GetInterfaceAddresses()[0]
 					ngrAddrsStr := string(ngrAddrsBytes)
 
+					// Get the active areas of the adjacency
+					areas := make([]string, 0)
+					for _, area := range nbr.GetNeighborActiveAreaAddresses() {
+						areas = append(areas, area.GetValue())
+					}
+
 					// Create ISISTelemetry struct
 					newIsisTelemetry := model.ISISTelemetry{
 						LocalInterface:lif,
 						NeighbourIp:ngrAddrsStr,
 						TimeStamp: ts,
 						NodeName:node.Name,
+						Areas: areas,
 					}
 					// Check if exists in database
 					dbResult := model.ISISTelemetry{}
@@ -373,7 +402,8 @@ func (node Node) CollectISISData(isisChannel chan model.TelemetryWrapper) {
 						if err != nil {
 							log.Fatal(err)
 						}
-						if (dbResult.NeighbourIp != newIsisTelemetry.NeighbourIp) {
+						if (dbResult.NeighbourIp != newIsisTelemetry.NeighbourIp ||
+							!reflect.DeepEqual(dbResult.Areas, newIsisTelemetry.Areas)) {
 							// Changed detected
 							changed = true
 						}
@@ -426,6 +456,8 @@ func (node Node) CollectISISData(isisChannel chan model.TelemetryWrapper) {
 
 		}
 
+		networkMetrics.setAdjacencies(node.Name, node.Generation, adjacencySamples)
+
 		// Search for old saved messages
 		count, err := dbCollection.Find(bson.M{"timestamp": previousTs}).Count()
 
@@ -450,10 +482,10 @@ func (node Node) CollectISISData(isisChannel chan model.TelemetryWrapper) {
 	}
 }
 
-func (node Node) watchForOldData(isisChannel chan model.TelemetryWrapper) {
+func (node Node) watchForOldData(ctx context.Context, isisChannel chan model.TelemetryWrapper) {
 
 	// Open database
-	session, err := mgo.Dial(os.Getenv("TELEMETRY_DB"))
+	session, err := mgo.Dial(currentConfig().Database)
 
 	if err != nil {
 		panic(err)
@@ -466,7 +498,7 @@ func (node Node) watchForOldData(isisChannel chan model.TelemetryWrapper) {
 		// Switch the session to a monotonic behavior.
 		session.SetMode(mgo.Monotonic, true)
 
-		dbCollection := session.DB("Telemetry").C("ISIS")
+		dbCollection := session.DB(currentConfig().DatabaseName).C("ISIS")
 		count, err := dbCollection.Find(bson.M{"nodename": node.Name}).Count()
 		if err != nil {
 			log.Fatalf("Cannot get data in isis table: %v\n", err)
@@ -504,6 +536,10 @@ func (node Node) watchForOldData(isisChannel chan model.TelemetryWrapper) {
 			isisChannel <- model.TelemetryWrapper{}
 		}
 
-		time.Sleep(time.Second * 5)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second * 5):
+		}
 	}
 }
\ No newline at end of file
@@ -18,7 +18,6 @@
 package controller
 
 import (
-	"html/template"
 	"net/http"
 	"github.com/gorilla/mux"
 	"io/ioutil"
@@ -27,43 +26,53 @@ import (
 	"github.com/sfloresk/tviewer/model"
 	"encoding/json"
 	"log"
+	"math"
 	"github.com/gorilla/websocket"
 	"github.com/go-fsnotify/fsnotify"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"sort"
+	"time"
 )
 
 type topology struct {
-	topologyTemplate *template.Template
-	broadcast        chan model.Topology      // broadcast channel
-	clients          map[*websocket.Conn]bool // connected clients
+	hub              *hub // connected clients
 	wsUpgrader       websocket.Upgrader
+	telemetryChannel chan model.TelemetryWrapper
 }
 
 func (t topology) registerRoutes(r *mux.Router) {
-	r.HandleFunc("/ng/topology", t.handleTemplate)
-	r.HandleFunc("/api/topology", t.handleTopology)
-	r.HandleFunc("/ws/topology", t.handleWSConnections)
+	r.HandleFunc("/ng/topology", requireRole(roleViewer, t.handleTemplate))
+	// Replaces the topology with the one in model/topology.json
+	r.HandleFunc("/api/topology", requireRole(roleAdmin, t.handleTopology))
+	r.HandleFunc("/api/annotations", requireRole(roleViewer, t.handleListAnnotations)).Methods("GET")
+	r.HandleFunc("/api/annotations", handleMethodNotAllowed)
+	r.HandleFunc("/api/annotations/{node}", requireRole(roleOperator, t.handleSetAnnotation)).Methods("PUT")
+	r.HandleFunc("/api/annotations/{node}", requireRole(roleOperator, t.handleDeleteAnnotation)).Methods("DELETE")
+	r.HandleFunc("/api/annotations/{node}", handleMethodNotAllowed)
+	r.HandleFunc("/ws/topology", requireRole(roleViewer, t.handleWSConnections))
+	r.HandleFunc("/sse/topology", requireRole(roleViewer, t.handleSSE))
 }
 
 func (t topology) handleTemplate(w http.ResponseWriter, r *http.Request) {
-	t.topologyTemplate.Execute(w, nil)
+	page("topology.html").Execute(w, nil)
 }
 
 func (t topology) handleTopology(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
-		raw, err := ioutil.ReadFile(basePath + "/model/topology.json")
+		topology, err := readTopologyFile()
+		if os.IsNotExist(err) {
+			writeAPIError(w, http.StatusNotFound, codeNotFound, "No topology file, " + topologyFile() + " does not exist")
+			return
+		}
 		if err != nil {
-
-			fmt.Println(err.Error())
-			os.Exit(1)
+			writeAPIError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
 		}
-		var topology model.Topology
-		json.Unmarshal(raw, &topology)
 		enc := json.NewEncoder(w)
 		enc.Encode(topology)
-		t.broadcast <- topology
+		t.hub.update <- topology.Nodes
 		break
 	default:
 		w.WriteHeader(http.StatusBadRequest)
@@ -71,60 +80,163 @@ func (t topology) handleTopology(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// topologyFile is the topology read by /api/topology and WatchTopologyFile
+func topologyFile() string {
+	return currentConfig().BasePath + "/model/topology.json"
+}
+
+func readTopologyFile() (model.Topology, error) {
+	var topology model.Topology
+	raw, err := ioutil.ReadFile(topologyFile())
+	if err != nil {
+		return topology, err
+	}
+	if err = json.Unmarshal(raw, &topology); err != nil {
+		return topology, fmt.Errorf("invalid topology file: %v", err)
+	}
+	return topology, nil
+}
+
+func (t topology) handleListAnnotations(w http.ResponseWriter, r *http.Request) {
+	annotations, err := listAnnotations()
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, annotations)
+}
+
+func (t topology) handleSetAnnotation(w http.ResponseWriter, r *http.Request) {
+	var annotation model.Annotation
+	if !decodeJSONBody(w, r, &annotation) {
+		return
+	}
+	annotation, err := setAnnotation(mux.Vars(r)["node"], annotation.Text, requestUser(r).Name, t.telemetryChannel)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, annotation)
+}
+
+func (t topology) handleDeleteAnnotation(w http.ResponseWriter, r *http.Request) {
+	if err := deleteAnnotation(mux.Vars(r)["node"], t.telemetryChannel, requestUser(r).Name); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (t topology) handleWSConnections(w http.ResponseWriter, r *http.Request) {
 	// Upgrade initial GET request to a websocket
 	ws, err := t.wsUpgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("Cannot upgrade websocket connection: %v", err)
+		return
 	}
-	// Register our new client
-	t.clients[ws] = true
 
-	// Trigger information to client
-	topology := t.createTopology();
-	ws.WriteJSON(topology)
+	// ?mode=full keeps the legacy behaviour of sending the whole topology on every change
+	client := newWSClient(t.hub, ws, r.URL.Query().Get("mode") == "full")
+	client.user = requestUser(r)
+	client.telemetryChannel = t.telemetryChannel
+
+	// Register our new client. The hub sends the current snapshot
+	t.hub.register <- client.hubClient
+
+	websockets.Add(1)
+	metricWebsocketClients.WithLabelValues("topology").Inc()
+	go client.writePump()
+	go client.readPump()
 }
 
-func (t topology) sendTopology() {
+// Time between topology rebuilds without telemetry changes, so the
+// utilization layer follows the traffic
+const utilizationRefresh = 10 * time.Second
+
+// Relative change of a rate below which the utilization layer keeps the
+// previous value, so the clients are not patched for every sample
+const utilizationThreshold = 0.1
+
+func (t topology) watchTopologyChanges(telemetryChannel chan model.TelemetryWrapper) {
+	// Version 1 is whatever is in the database at startup
+	topology := t.rebuildTopology()
+	t.hub.update <- topology
+	refresh := time.NewTicker(utilizationRefresh)
+	defer refresh.Stop()
 	for {
-		// Grab the next message from the broadcast channel
-		topology := <-t.broadcast
-		// Send it out to every client that is currently connected
-		for client := range t.clients {
-			err := client.WriteJSON(topology)
-			if err != nil {
-				log.Printf("error: %v", err)
-				client.Close()
-				delete(t.clients, client)
-			}
+		// Grab any message from the telemetry channel. If a new message arrives, topology has changed
+		select {
+		case <-telemetryChannel:
+		case <-refresh.C:
 		}
+		previous := topology
+		topology = t.rebuildTopology()
+		settleUtilization(previous, topology)
+		// Send it out to every client that is currently connected. The hub
+		// drops it if nothing changed
+		t.hub.update <- topology
 	}
+
 }
 
-func (t topology) watchTopologyChanges(telemetryChannel chan model.TelemetryWrapper) {
-	for {
-		// Grab any message from the telemetry channel. If a new message arrives, topology has changed
-		_ = <-telemetryChannel
-		topology := t.createTopology();
-		// TODO: Debug
-		fmt.Printf("Sending information to clients -> %v \n\n", topology)
-		// Send it out to every client that is currently connected
-		for client := range t.clients {
-			err := client.WriteJSON(topology)
-			if err != nil {
-				log.Printf("error: %v", err)
-				client.Close()
-				delete(t.clients, client)
+// interfaceUtilization returns the rates of an interface of the node, from
+// the samples of the collectors, or nil while they are not known. They are
+// rounded, so the topology does not change with the noise.
+func interfaceUtilization(node string, iface string) *model.Utilization {
+	networkMetrics.mu.Lock()
+	defer networkMetrics.mu.Unlock()
+
+	sample, ok := networkMetrics.interfaces[node].samples[iface]
+	if !ok || !sample.hasRates {
+		return nil
+	}
+	return &model.Utilization{
+		ReceiveBps:  math.Round(sample.receiveByteRate * 8),
+		TransmitBps: math.Round(sample.transmitByteRate * 8),
+		ReceivePps:  math.Round(sample.receivePacketRate),
+		TransmitPps: math.Round(sample.transmitPacketRate),
+	}
+}
+
+// settleUtilization keeps in next the utilization of previous for the
+// interfaces whose rates all changed less than utilizationThreshold
+func settleUtilization(previous []model.Node, next []model.Node) {
+	sent := make(map[string]*model.Utilization)
+	for _, node := range previous {
+		for _, iface := range node.Interfaces {
+			sent[node.Name + "/" + iface.Name] = iface.Utilization
+		}
+	}
+	for j := range next {
+		for k := range next[j].Interfaces {
+			iface := &next[j].Interfaces[k]
+			last, ok := sent[next[j].Name + "/" + iface.Name]
+			if ok && last != nil && iface.Utilization != nil && !utilizationChanged(*last, *iface.Utilization) {
+				iface.Utilization = last
 			}
 		}
 	}
+}
+
+func utilizationChanged(last model.Utilization, current model.Utilization) bool {
+	return rateChanged(last.ReceiveBps, current.ReceiveBps) ||
+		rateChanged(last.TransmitBps, current.TransmitBps) ||
+		rateChanged(last.ReceivePps, current.ReceivePps) ||
+		rateChanged(last.TransmitPps, current.TransmitPps)
+}
 
+func rateChanged(last float64, current float64) bool {
+	return math.Abs(current - last) > utilizationThreshold * math.Max(last, current)
 }
 
+// WatchTopologyFile sends the topology of model/topology.json to the clients
+// every time the file is written. Errors are logged and the previous
+// topology is kept.
 func (t topology) WatchTopologyFile() {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("Cannot watch the topology file: %v", err)
+		return
 	}
 	defer watcher.Close()
 
@@ -136,14 +248,12 @@ func (t topology) WatchTopologyFile() {
 				log.Println("event:", event)
 				if event.Op & fsnotify.Write == fsnotify.Write {
 					log.Println("modified file:", event.Name)
-					raw, err := ioutil.ReadFile(basePath + "/model/topology.json")
+					topology, err := readTopologyFile()
 					if err != nil {
-						fmt.Println(err.Error())
-						os.Exit(1)
+						log.Printf("Cannot read the topology file: %v", err)
+						continue
 					}
-					var topology model.Topology
-					json.Unmarshal(raw, &topology)
-					t.broadcast <- topology
+					t.hub.update <- topology.Nodes
 				}
 			case err := <-watcher.Errors:
 				log.Println("error:", err)
@@ -151,19 +261,28 @@ func (t topology) WatchTopologyFile() {
 		}
 	}()
 
-	err = watcher.Add(basePath + "/model/")
+	err = watcher.Add(currentConfig().BasePath + "/model/")
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("Cannot watch the topology file: %v", err)
+		return
 	}
 	<-done
 }
 
+// rebuildTopology is createTopology, timed for the metrics
+func (t topology) rebuildTopology() []model.Node {
+	start := time.Now()
+	topology := t.createTopology()
+	metricTopologyRebuild.Observe(time.Since(start).Seconds())
+	return topology
+}
+
 func (t topology) createTopology() ([]model.Node) {
 	topology := make([]model.Node, 0)
 	// Build topology from database
 
 	// Open database
-	session, err := mgo.Dial(os.Getenv("TELEMETRY_DB"))
+	session, err := mgo.Dial(currentConfig().Database)
 	if err != nil {
 		panic(err)
 	}
@@ -172,7 +291,7 @@ func (t topology) createTopology() ([]model.Node) {
 	// Switch the session to a monotonic behavior.
 	session.SetMode(mgo.Monotonic, true)
 
-	dbCollection := session.DB("Telemetry").C("Interfaces")
+	dbCollection := session.DB(currentConfig().DatabaseName).C("Interfaces")
 
 	var interfaces []model.InterfaceTelemetry
 	// Get all rows
@@ -199,7 +318,8 @@ func (t topology) createTopology() ([]model.Node) {
 			newNode := model.Node{
 				Name:interfaces[i].NodeName,
 				Interfaces: make([]model.Interface, 0),
-
+				Tags: make([]string, 0),
+				Areas: make([]string, 0),
 			}
 			topology = append(topology, newNode)
 			topology[len(topology) - 1].Interfaces = append(topology[len(topology) - 1].Interfaces,
@@ -214,7 +334,7 @@ func (t topology) createTopology() ([]model.Node) {
 	// Add ISIS Neighbours
 	var isisNeighboursDb []model.ISISTelemetry
 
-	dbCollection = session.DB("Telemetry").C("ISIS")
+	dbCollection = session.DB(currentConfig().DatabaseName).C("ISIS")
 	// Get all rows
 	dbCollection.Find(bson.M{}).All(&isisNeighboursDb)
 
@@ -228,12 +348,66 @@ func (t topology) createTopology() ([]model.Node) {
 						topology[j].Interfaces[k].IsisNeighbours = append(topology[j].Interfaces[k].IsisNeighbours,
 							model.IsisNeighbor{
 								IPv4:isisNeighboursDb[i].NeighbourIp,
+								Areas:isisNeighboursDb[i].Areas,
 							})
 					}
 				}
+				// The node is in every area of its adjacencies
+				for _, area := range isisNeighboursDb[i].Areas {
+					if (!containsString(topology[j].Areas, area)) {
+						topology[j].Areas = append(topology[j].Areas, area)
+					}
+				}
 			}
 		}
 	}
+
+	// Add interface utilization, from the samples of the collectors
+	for j := range topology {
+		for k := range topology[j].Interfaces {
+			topology[j].Interfaces[k].Utilization = interfaceUtilization(topology[j].Name, topology[j].Interfaces[k].Name)
+		}
+	}
+
+	// Add operator annotations
+	var annotations []model.Annotation
+
+	dbCollection = session.DB(currentConfig().DatabaseName).C("Annotations")
+	dbCollection.Find(bson.M{}).All(&annotations)
+
+	for i := range annotations {
+		for j := range topology {
+			if (topology[j].Name == annotations[i].Node) {
+				topology[j].Annotation = annotations[i].Text
+			}
+		}
+	}
+
+	// Add device tags
+	var devices []model.Device
+
+	dbCollection = session.DB(currentConfig().DatabaseName).C("Devices")
+	dbCollection.Find(bson.M{}).All(&devices)
+
+	for i := range devices {
+		for j := range topology {
+			if (topology[j].Name == devices[i].Name && devices[i].Tags != nil) {
+				topology[j].Tags = devices[i].Tags
+			}
+		}
+	}
+
+	// Keep a stable order so consecutive topologies diff cleanly
+	sort.Slice(topology, func(i, j int) bool {
+		return topology[i].Name < topology[j].Name
+	})
+	for i := range topology {
+		interfaces := topology[i].Interfaces
+		sort.Slice(interfaces, func(j, k int) bool {
+			return interfaces[j].Name < interfaces[k].Name
+		})
+		sort.Strings(topology[i].Areas)
+	}
 	return topology
 
 }
\ No newline at end of file
@@ -0,0 +1,169 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"github.com/gorilla/mux"
+)
+
+// users manages the local users and their API tokens
+type users struct {
+}
+
+type userRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+	// Required to change your own password
+	CurrentPassword string `json:"currentPassword"`
+}
+
+type tokenRequest struct {
+	Name string `json:"name"`
+}
+
+func (u users) registerRoutes(r *mux.Router) {
+	r.HandleFunc("/api/users", requireRole(roleAdmin, u.handleListUsers)).Methods("GET")
+	r.HandleFunc("/api/users", requireRole(roleAdmin, u.handleCreateUser)).Methods("POST")
+	r.HandleFunc("/api/users", handleMethodNotAllowed)
+	r.HandleFunc("/api/users/{name}", requireRole(roleAdmin, u.handleDeleteUser)).Methods("DELETE")
+	r.HandleFunc("/api/users/{name}", handleMethodNotAllowed)
+	r.HandleFunc("/api/users/{name}/role", requireRole(roleAdmin, u.handleSetRole)).Methods("PUT")
+	r.HandleFunc("/api/users/{name}/role", handleMethodNotAllowed)
+	// Users change their own password, admins any password
+	r.HandleFunc("/api/users/{name}/password", requireRole(roleViewer, u.handleSetPassword)).Methods("PUT")
+	r.HandleFunc("/api/users/{name}/password", handleMethodNotAllowed)
+	r.HandleFunc("/api/tokens", requireRole(roleViewer, u.handleListTokens)).Methods("GET")
+	r.HandleFunc("/api/tokens", requireRole(roleViewer, u.handleCreateToken)).Methods("POST")
+	r.HandleFunc("/api/tokens", handleMethodNotAllowed)
+	r.HandleFunc("/api/tokens/{id}", requireRole(roleViewer, u.handleDeleteToken)).Methods("DELETE")
+	r.HandleFunc("/api/tokens/{id}", handleMethodNotAllowed)
+}
+
+func (u users) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := listUsers()
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+func (u users) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var request userRequest
+	if !decodeJSONBody(w, r, &request) {
+		return
+	}
+	user, err := addUser(request.Name, request.Password, request.Role, requestUser(r).Name)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/api/users/" + user.Name)
+	writeJSON(w, http.StatusCreated, user)
+}
+
+func (u users) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	if err := deleteUser(mux.Vars(r)["name"], requestUser(r).Name); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u users) handleSetRole(w http.ResponseWriter, r *http.Request) {
+	var request userRequest
+	if !decodeJSONBody(w, r, &request) {
+		return
+	}
+	if err := setUserRole(mux.Vars(r)["name"], request.Role, requestUser(r).Name); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSetPassword changes the password and ends the sessions of the user.
+// Users give their current password, so a stolen session or token is not
+// enough to lock them out; admins reset the password of others without it.
+func (u users) handleSetPassword(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	user := requestUser(r)
+	if name != user.Name && !allowed(user, roleAdmin, "changing the password of " + name) {
+		writeAPIError(w, http.StatusForbidden, codeForbidden, "Role " + roleAdmin + " required to change the password of another user")
+		return
+	}
+	var request userRequest
+	if !decodeJSONBody(w, r, &request) {
+		return
+	}
+	if name == user.Name {
+		if _, ok := checkPassword(name, request.CurrentPassword); !ok {
+			recordAudit(user.Name, auditUserPassword, name, "", errors.New("wrong current password"))
+			writeAPIError(w, http.StatusForbidden, codeForbidden, "Current password is wrong")
+			return
+		}
+	}
+	if err := setUserPassword(name, request.Password, user.Name); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Tokens are always those of the user making the request
+
+func (u users) handleListTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := listTokens(requestUser(r).Name)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// handleCreateToken returns the token, which cannot be read again later
+func (u users) handleCreateToken(w http.ResponseWriter, r *http.Request) {
+	var request tokenRequest
+	if !decodeJSONBody(w, r, &request) {
+		return
+	}
+	apiToken, token, err := createToken(requestUser(r).Name, request.Name)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/api/tokens/" + apiToken.ID)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"id":      apiToken.ID,
+		"name":    apiToken.Name,
+		"user":    apiToken.User,
+		"created": apiToken.Created,
+		"token":   token,
+	})
+}
+
+func (u users) handleDeleteToken(w http.ResponseWriter, r *http.Request) {
+	if err := deleteToken(requestUser(r).Name, mux.Vars(r)["id"]); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
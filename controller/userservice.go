@@ -0,0 +1,375 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"time"
+	"github.com/sfloresk/tviewer/model"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// User and API token operations shared by the API layers
+
+// Prefix of API tokens, so they are easy to spot in scripts and logs
+const apiTokenPrefix = "tv_"
+
+// Minimum password length of local users
+const minPasswordLength = 8
+
+// openCollection opens another collection of the telemetry database
+func openCollection(name string) (*mgo.Session, *mgo.Collection, error) {
+	session, _, err := openDevicesCollection()
+	if err != nil {
+		return nil, nil, err
+	}
+	return session, session.DB(currentConfig().DatabaseName).C(name), nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func listUsers() ([]model.User, error) {
+	session, dbCollection, err := openCollection("Users")
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	users := make([]model.User, 0)
+	if err = dbCollection.Find(nil).All(&users); err != nil {
+		return nil, fmt.Errorf("cannot read users table: %v", err)
+	}
+	return users, nil
+}
+
+func getUser(name string) (model.User, error) {
+	var user model.User
+
+	session, dbCollection, err := openCollection("Users")
+	if err != nil {
+		return user, err
+	}
+	defer session.Close()
+
+	err = dbCollection.Find(bson.M{"name": name}).One(&user)
+	if err == mgo.ErrNotFound {
+		return user, newServiceError(errorNotFound, "User %v not found", name)
+	}
+	if err != nil {
+		return user, fmt.Errorf("cannot read users table: %v", err)
+	}
+	return user, nil
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", newServiceError(errorInvalid, "Password must have at least %v characters", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// addUser creates a user, a viewer unless another role is given
+func addUser(name string, password string, role string, actor string) (user model.User, err error) {
+	defer func() {
+		recordAudit(actor, auditUserCreate, name, "", err)
+	}()
+
+	if role == "" {
+		role = roleViewer
+	}
+	user = model.User{Name: name, Role: role}
+	if !deviceNamePattern.MatchString(name) {
+		return user, newServiceError(errorInvalid, "Name %v can only contain letters, digits, '.', '_' and '-'", name)
+	}
+	if !validRole(role) {
+		return user, newServiceError(errorInvalid, "Role must be %v, %v or %v", roleViewer, roleOperator, roleAdmin)
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return user, err
+	}
+	user.PasswordHash = hash
+
+	session, dbCollection, err := openCollection("Users")
+	if err != nil {
+		return user, err
+	}
+	defer session.Close()
+
+	count, err := dbCollection.Find(bson.M{"name": name}).Count()
+	if err != nil {
+		return user, fmt.Errorf("cannot read users table: %v", err)
+	}
+	if (count > 0) {
+		return user, newServiceError(errorConflict, "User %v already exists", name)
+	}
+	if err = dbCollection.Insert(&user); err != nil {
+		return user, fmt.Errorf("cannot insert in users table: %v", err)
+	}
+	return user, nil
+}
+
+// checkOtherAdmins fails if name is the last admin, who could not be replaced
+func checkOtherAdmins(dbCollection *mgo.Collection, name string) error {
+	count, err := dbCollection.Find(bson.M{"name": bson.M{"$ne": name}, "role": roleAdmin}).Count()
+	if err != nil {
+		return fmt.Errorf("cannot read users table: %v", err)
+	}
+	if (count == 0) {
+		return newServiceError(errorConflict, "User %v is the last admin", name)
+	}
+	return nil
+}
+
+func setUserRole(name string, role string, actor string) (err error) {
+	defer func() {
+		recordAudit(actor, auditUserRole, name, "", err)
+	}()
+
+	if !validRole(role) {
+		return newServiceError(errorInvalid, "Role must be %v, %v or %v", roleViewer, roleOperator, roleAdmin)
+	}
+
+	session, dbCollection, err := openCollection("Users")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	if role != roleAdmin {
+		if err = checkOtherAdmins(dbCollection, name); err != nil {
+			return err
+		}
+	}
+	err = dbCollection.Update(bson.M{"name": name}, bson.M{"$set": bson.M{"role": role}})
+	if err == mgo.ErrNotFound {
+		return newServiceError(errorNotFound, "User %v not found", name)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot update users table: %v", err)
+	}
+	return nil
+}
+
+func setUserPassword(name string, password string, actor string) (err error) {
+	defer func() {
+		recordAudit(actor, auditUserPassword, name, "", err)
+	}()
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	session, dbCollection, err := openCollection("Users")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	err = dbCollection.Update(bson.M{"name": name}, bson.M{"$set": bson.M{"passwordhash": hash}})
+	if err == mgo.ErrNotFound {
+		return newServiceError(errorNotFound, "User %v not found", name)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot update users table: %v", err)
+	}
+	sessions.revokeUser(name)
+	return nil
+}
+
+// deleteUser removes the user with its tokens and sessions
+func deleteUser(name string, actor string) (err error) {
+	defer func() {
+		recordAudit(actor, auditUserDelete, name, "", err)
+	}()
+
+	session, dbCollection, err := openCollection("Users")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	// Keep at least one admin, or nobody could manage users again
+	if err = checkOtherAdmins(dbCollection, name); err != nil {
+		return err
+	}
+	err = dbCollection.Remove(bson.M{"name": name})
+	if err == mgo.ErrNotFound {
+		return newServiceError(errorNotFound, "User %v not found", name)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot delete data in users table: %v", err)
+	}
+	_, err = session.DB(currentConfig().DatabaseName).C("Tokens").RemoveAll(bson.M{"user": name})
+	if err != nil {
+		return fmt.Errorf("cannot delete data in tokens table: %v", err)
+	}
+	sessions.revokeUser(name)
+	return nil
+}
+
+// Compared against for unknown users, so they cannot be told apart by timing
+var unknownUserHash, _ = bcrypt.GenerateFromPassword([]byte(randomHex(16)), bcrypt.DefaultCost)
+
+// checkPassword returns the user if the password matches
+func checkPassword(name string, password string) (model.User, bool) {
+	user, err := getUser(name)
+	if err != nil {
+		// Spend the same time as a wrong password
+		bcrypt.CompareHashAndPassword(unknownUserHash, []byte(password))
+		return user, false
+	}
+	return user, bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+}
+
+// createToken returns the stored token and the token itself
+func createToken(user string, name string) (apiToken model.APIToken, token string, err error) {
+	token = apiTokenPrefix + randomHex(32)
+	apiToken = model.APIToken{
+		ID:      randomHex(8),
+		Name:    name,
+		User:    user,
+		Hash:    hashToken(token),
+		Created: time.Now(),
+	}
+
+	session, dbCollection, err := openCollection("Tokens")
+	if err != nil {
+		return apiToken, "", err
+	}
+	defer session.Close()
+
+	err = dbCollection.Insert(&apiToken)
+	recordAudit(user, auditTokenCreate, apiToken.ID, "", err)
+	if err != nil {
+		return apiToken, "", fmt.Errorf("cannot insert in tokens table: %v", err)
+	}
+	return apiToken, token, nil
+}
+
+func listTokens(user string) ([]model.APIToken, error) {
+	session, dbCollection, err := openCollection("Tokens")
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	tokens := make([]model.APIToken, 0)
+	if err = dbCollection.Find(bson.M{"user": user}).All(&tokens); err != nil {
+		return nil, fmt.Errorf("cannot read tokens table: %v", err)
+	}
+	return tokens, nil
+}
+
+func deleteToken(user string, id string) (err error) {
+	defer func() {
+		recordAudit(user, auditTokenDelete, id, "", err)
+	}()
+
+	session, dbCollection, err := openCollection("Tokens")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	err = dbCollection.Remove(bson.M{"user": user, "id": id})
+	if err == mgo.ErrNotFound {
+		return newServiceError(errorNotFound, "Token %v not found", id)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot delete data in tokens table: %v", err)
+	}
+	return nil
+}
+
+// userForToken returns the user that owns the token
+func userForToken(token string) (model.User, bool) {
+	var apiToken model.APIToken
+
+	session, dbCollection, err := openCollection("Tokens")
+	if err != nil {
+		log.Print(err)
+		return model.User{}, false
+	}
+	defer session.Close()
+
+	if err = dbCollection.Find(bson.M{"hash": hashToken(token)}).One(&apiToken); err != nil {
+		return model.User{}, false
+	}
+	user, err := getUser(apiToken.User)
+	return user, err == nil
+}
+
+// bootstrapAdmin creates the admin user when there are no users, with the
+// password in TVIEWER_ADMIN_PASSWORD or a random one written to the log
+func bootstrapAdmin() error {
+	session, dbCollection, err := openCollection("Users")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	// Users created before roles existed could do everything
+	_, err = dbCollection.UpdateAll(bson.M{"role": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"role": roleAdmin}})
+	if err != nil {
+		return fmt.Errorf("cannot update users table: %v", err)
+	}
+
+	users, err := listUsers()
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		return nil
+	}
+	password := os.Getenv("TVIEWER_ADMIN_PASSWORD")
+	generated := password == ""
+	if generated {
+		password = randomHex(12)
+	}
+	if _, err = addUser("admin", password, roleAdmin, actorSystem); err != nil {
+		return err
+	}
+	if generated {
+		log.Printf("Created user admin with password %v, change it after the first login", password)
+	} else {
+		log.Print("Created user admin with the password in TVIEWER_ADMIN_PASSWORD")
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+	"github.com/gorilla/websocket"
+	"github.com/sfloresk/tviewer/model"
+)
+
+const (
+	// Time allowed to write a message to the client
+	wsWriteWait = 10 * time.Second
+	// Time allowed to read the next pong message from the client
+	wsPongWait = 60 * time.Second
+	// Ping period, must be less than wsPongWait
+	wsPingPeriod = (wsPongWait * 9) / 10
+	// Maximum size of a message sent by the client
+	wsMaxMessageSize = 4096
+)
+
+type wsClientMessage struct {
+	Type   string          `json:"type"`
+	Filter *topologyFilter `json:"filter"`
+	// Annotate and restart actions
+	Node   string          `json:"node"`
+	Text   string          `json:"text"`
+}
+
+// wsClient carries a hub client over a websocket connection. Only writePump
+// writes to conn and only readPump reads from it.
+type wsClient struct {
+	*hubClient
+	hub  *hub
+	conn *websocket.Conn
+	// Logged in user, whose role limits the actions it can send
+	user             model.User
+	telemetryChannel chan model.TelemetryWrapper
+}
+
+func newWSClient(h *hub, conn *websocket.Conn, fullSnapshots bool) *wsClient {
+	return &wsClient{
+		hubClient: newHubClient(conn.RemoteAddr().String(), fullSnapshots),
+		hub:       h,
+		conn:      conn,
+	}
+}
+
+// action runs an annotate or restart request. Errors, including denied
+// actions, are sent back to the client.
+func (c *wsClient) action(message wsClientMessage) {
+	if !allowed(c.user, roleOperator, "websocket action " + message.Type + " on " + message.Node) {
+		c.hub.fail <- clientError{client: c.hubClient, err: fmt.Errorf("Role %v required for %v", roleOperator, message.Type)}
+		return
+	}
+	var err error
+	switch message.Type {
+	case messageAnnotate:
+		if message.Text == "" {
+			err = deleteAnnotation(message.Node, c.telemetryChannel, c.user.Name)
+		} else {
+			_, err = setAnnotation(message.Node, message.Text, c.user.Name, c.telemetryChannel)
+		}
+	case messageRestart:
+		err = restartCollectors(message.Node, c.telemetryChannel, c.user.Name)
+	}
+	if err != nil {
+		c.hub.fail <- clientError{client: c.hubClient, err: err}
+	}
+}
+
+// readPump handles resync, subscribe, annotate and restart requests, keeps the read deadline
+// moving with every pong and unregisters the client once the connection
+// fails or is closed by the peer.
+func (c *wsClient) readPump() {
+	defer func() {
+		c.hub.unregister <- c.hubClient
+		c.conn.Close()
+	}()
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		return nil
+	})
+	for {
+		_, raw, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("websocket error: %v", err)
+			}
+			return
+		}
+		var message wsClientMessage
+		if err := json.Unmarshal(raw, &message); err != nil {
+			log.Printf("Ignoring malformed websocket message: %v", err)
+			continue
+		}
+		switch message.Type {
+		case messageResync:
+			c.hub.resync <- c.hubClient
+		case messageSubscribe:
+			c.hub.subscribe <- subscription{client: c.hubClient, filter: message.Filter}
+		case messageAnnotate, messageRestart:
+			c.action(message)
+		default:
+			log.Printf("Ignoring websocket message of type %q", message.Type)
+		}
+	}
+}
+
+// writePump drains the send queue to the connection and pings the client
+// periodically so dead peers are detected by the read deadline.
+func (c *wsClient) writePump() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+		metricWebsocketClients.WithLabelValues("topology").Dec()
+		websockets.Done()
+	}()
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if !ok {
+				// The hub closed the queue
+				c.conn.WriteMessage(websocket.CloseMessage, closeFrame())
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, message.Data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// closeFrame is the payload of the close message sent to websocket clients,
+// which tells them when the server is going away
+func closeFrame() []byte {
+	select {
+	case <-shuttingDown:
+		return websocket.FormatCloseMessage(websocket.CloseGoingAway, "tviewer is shutting down")
+	default:
+		return []byte{}
+	}
+}
+
+// Messages sent on /ws/jobs
+const (
+	messageJobs = "jobs"
+	messageJob  = "job"
+)
+
+// serveJobs writes the current onboarding jobs, then every change to them,
+// until the client goes away or stops keeping up
+func serveJobs(conn *websocket.Conn) {
+	watcher := jobs.watch()
+	defer func() {
+		jobs.unwatch(watcher)
+		conn.Close()
+		metricWebsocketClients.WithLabelValues("jobs").Dec()
+		websockets.Done()
+	}()
+
+	// Nothing is expected from the client, read only to process pongs and
+	// notice when it is gone
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(wsMaxMessageSize)
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.SetPongHandler(func(string) error {
+			conn.SetReadDeadline(time.Now().Add(wsPongWait))
+			return nil
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	if err := conn.WriteJSON(map[string]interface{}{"type": messageJobs, "data": jobs.list()}); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case job, ok := <-watcher:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if !ok {
+				// Evicted for not keeping up, or shutting down
+				conn.WriteMessage(websocket.CloseMessage, closeFrame())
+				return
+			}
+			if err := conn.WriteJSON(map[string]interface{}{"type": messageJob, "data": job}); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -18,57 +18,122 @@
 package main
 
 import (
+	"context"
+	"embed"
+	"fmt"
 	"github.com/gorilla/mux"
 	"html/template"
+	"io/fs"
 	"net/http"
 	"os"
-	"io/ioutil"
+	"os/signal"
+	"syscall"
+	"time"
 	"github.com/sfloresk/tviewer/controller"
 	"log"
 )
 
-func main() {
+// Templates and static files, so tviewer runs from any directory
+//go:embed all:templates all:public oc-templates api/openapi.json
+var embedded embed.FS
 
+// Time allowed for the shutdown before the process exits anyway
+const shutdownTimeout = 30 * time.Second
+
+func main() {
+	config, err := controller.LoadConfig()
+	if err != nil {
+		log.Fatal("Invalid configuration: " + err.Error())
+	}
 
 	r := mux.NewRouter()
 
-	templates := populateTemplates()
+	assets := controller.OverlayAssets(embedded)
+	templates, err := populateTemplates(assets)
+	if err != nil {
+		log.Fatal(err)
+	}
+	controller.SetAssets(assets)
 
 	controller.Startup(templates, r)
-	log.Println("Listening in http://0.0.0.0:9090/web/")
-	http.ListenAndServe(":9090", r)
+
+	go func() {
+		log.Println("gRPC API listening in " + config.GRPCListen)
+		err := controller.ServeGRPC(config.GRPCListen)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	go func() {
+		err := controller.ListenAndServe(r)
+		if err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range signals {
+		if sig == syscall.SIGHUP {
+			reload()
+			continue
+		}
+		log.Printf("Received %v, shutting down", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		controller.Shutdown(ctx)
+		cancel()
+		log.Println("Stopped")
+		return
+	}
 }
 
-func populateTemplates() map[string]*template.Template {
+// reload applies the config file, the templates and the assets directory
+// again. Telemetry collectors keep running.
+func reload() {
+	_, err := controller.ReloadConfig()
+	if err != nil {
+		log.Printf("Not reloading, invalid configuration: %v", err)
+		return
+	}
+	assets := controller.OverlayAssets(embedded)
+	templates, err := populateTemplates(assets)
+	if err != nil {
+		log.Printf("Reloaded the configuration but not the templates: %v", err)
+		return
+	}
+	controller.SetAssets(assets)
+	controller.SetTemplates(templates)
+	log.Println("Reloaded the configuration, templates and assets")
+}
+
+func populateTemplates(assets fs.FS) (map[string]*template.Template, error) {
 	result := make(map[string]*template.Template)
-	const basePath = "src/github.com/sfloresk/tviewer/templates"
-	layout := template.Must(template.ParseFiles(basePath + "/_layout.html"))
-	template.Must(
-		layout.ParseFiles(basePath + "/_default_menu.html"))
-	dir, err := os.Open(basePath + "/content")
+	const basePath = "templates"
+	layout, err := template.ParseFS(assets, basePath + "/_layout.html", basePath + "/_default_menu.html")
 	if err != nil {
-		panic("Failed to open template blocks directory: " + err.Error())
+		return nil, fmt.Errorf("Failed to parse layout: %v", err)
 	}
-	fis, err := dir.Readdir(-1)
+	fis, err := fs.ReadDir(assets, basePath + "/content")
 	if err != nil {
-		panic("Failed to read contents of content directory: " + err.Error())
+		return nil, fmt.Errorf("Failed to read contents of content directory: %v", err)
 	}
 	for _, fi := range fis {
-		f, err := os.Open(basePath + "/content/" + fi.Name())
-		if err != nil {
-			panic("Failed to open template '" + fi.Name() + "'")
-		}
-		content, err := ioutil.ReadAll(f)
+		content, err := fs.ReadFile(assets, basePath + "/content/" + fi.Name())
 		if err != nil {
-			panic("Failed to read content from file '" + fi.Name() + "'")
+			return nil, fmt.Errorf("Failed to read content from file '%v'", fi.Name())
 		}
-		f.Close()
 		tmpl := template.Must(layout.Clone())
 		_, err = tmpl.Parse(string(content))
 		if err != nil {
-			panic("Failed to parse contents of '" + fi.Name() + "' as template")
+			return nil, fmt.Errorf("Failed to parse contents of '%v' as template: %v", fi.Name(), err)
 		}
 		result[fi.Name()] = tmpl
 	}
-	return result
-}
\ No newline at end of file
+	// The login page has no menu, it does not use the layout
+	result["login.html"], err = template.ParseFS(assets, basePath + "/login.html")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse login page: %v", err)
+	}
+	return result, nil
+}
@@ -17,12 +17,64 @@
  */
 package model
 
+import "time"
+
+// CertificateInfo describes a certificate given to tviewer
+type CertificateInfo struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	SANs      []string  `json:"sans,omitempty"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+	IsCA      bool      `json:"isCA"`
+}
+
+// TelemetryIDs are the telemetry settings pushed to a device when it was
+// onboarded. They are kept with the device, so later changes to the
+// configuration only apply to devices onboarded afterwards.
+type TelemetryIDs struct {
+	InterfaceSubscriptionID string `json:"interfaceSubscriptionID"`
+	ISISSubscriptionID      string `json:"isisSubscriptionID"`
+	InterfaceSensorGroupID  string `json:"interfaceSensorGroupID"`
+	ISISSensorGroupID       string `json:"isisSensorGroupID"`
+	// Sample interval in milliseconds of devices without one of their own
+	SampleInterval int `json:"sampleInterval"`
+}
+
 type Device struct {
 	Name        string `json:"name"`
 	Ip          string `json:"ip"`
 	Username    string `json:"username"`
-	Password    string `json:"password"`
+	// Write-only, never returned by the APIs
+	Password    string `json:"password,omitempty"`
 	Port        string `json:"port"`
+	// CA certificate of the router, or a CA chain, PEM encoded
 	Certificate string `json:"certificate"`
+	// Optional client certificate and key for mutual TLS, PEM encoded. The
+	// key is write-only.
+	ClientCertificate string `json:"clientCertificate,omitempty"`
+	ClientKey         string `json:"clientKey,omitempty"`
+	Tags        []string `json:"tags"`
+	// Name of the CredentialProfile whose username, password and
+	// certificate the device uses, empty to use its own
+	Profile string `json:"profile,omitempty"`
+	// Telemetry sample interval in milliseconds, 0 for the default
+	SampleInterval int `json:"sampleInterval"`
+	// "netbox" for devices added by the inventory sync, empty otherwise
+	Source string `json:"source,omitempty"`
+	// Set by the inventory sync when the device is gone from the source of truth
+	DecommissionPending bool `json:"decommissionPending,omitempty"`
+	// Set when Password and ClientKey are stored encrypted
+	Sealed bool `json:"-"`
+	// Read-only, set when the device is onboarded
+	Telemetry *TelemetryIDs `json:"telemetry,omitempty"`
+
+	// Read-only, parsed from the certificates when the device is saved
+	CertificateInfo       []CertificateInfo `json:"certificateInfo,omitempty"`
+	ClientCertificateInfo *CertificateInfo  `json:"clientCertificateInfo,omitempty"`
+	// Earliest expiry of the certificates
+	CertificateExpiry *time.Time `json:"certificateExpiry,omitempty"`
+	// Set in API responses when a certificate expires soon or has expired
+	CertificateExpiring bool `json:"certificateExpiring,omitempty" bson:"-"`
 }
 
@@ -0,0 +1,31 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package model
+
+// CredentialProfile holds the credentials shared by the devices that
+// reference it by name
+type CredentialProfile struct {
+	Name        string `json:"name"`
+	Username    string `json:"username"`
+	// Write-only, never returned by the APIs
+	Password    string `json:"password,omitempty"`
+	// PEM certificate used to connect, e.g. the CA of every device
+	Certificate string `json:"certificate"`
+	// Set when Password is stored encrypted
+	Sealed bool `json:"-"`
+}
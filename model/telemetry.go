@@ -33,6 +33,7 @@ type ISISTelemetry struct {
 	NodeName  string `json:"nodeName"`
 	LocalInterface string `json:"localInterface"`
 	NeighbourIp    string `json:"neighbourIp"`
+	Areas          []string `json:"areas"`
 }
 
 func (isisTelemetry ISISTelemetry) getType() string {
@@ -21,15 +21,29 @@ type Interface struct {
 	Name           string `json:"name"`
 	IsisNeighbours []IsisNeighbor `json:"isisNeighbours"`
 	IPv4           string `json:"ipv4"`
+	// Traffic between the last two samples, nil until known
+	Utilization    *Utilization `json:"utilization,omitempty"`
+}
+
+// Utilization is the traffic of an interface in bits and packets per second
+type Utilization struct {
+	ReceiveBps  float64 `json:"receiveBps"`
+	TransmitBps float64 `json:"transmitBps"`
+	ReceivePps  float64 `json:"receivePps"`
+	TransmitPps float64 `json:"transmitPps"`
 }
 
 type IsisNeighbor struct {
-	IPv4 string `json:"ipv4"`
+	IPv4  string `json:"ipv4"`
+	Areas []string `json:"areas"`
 }
 
 type Node struct {
 	Name   string `json:"name"`
 	Interfaces []Interface `json:"interfaces"`
+	Tags       []string `json:"tags"`
+	Areas      []string `json:"areas"`
+	Annotation string `json:"annotation,omitempty"`
 }
 
 type Topology struct {
@@ -0,0 +1,39 @@
+/**
+ * @license
+ * Copyright (c) 2018 Cisco and/or its affiliates.
+ *
+ * This software is licensed to you under the terms of the Cisco Sample
+ * Code License, Version 1.0 (the "License"). You may obtain a copy of the
+ * License at
+ *
+ *                https://developer.cisco.com/docs/licenses
+ *
+ * All use of the material herein must be in accordance with the terms of
+ * the License. All rights not expressly granted by the License are
+ * reserved. Unless required by applicable law or agreed to separately in
+ * writing, software distributed under the License is distributed on an "AS
+ * IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied.
+ */
+package model
+
+import "time"
+
+// User is a local account of the web UI and the APIs
+type User struct {
+	Name         string `json:"name"`
+	// viewer, operator or admin
+	Role         string `json:"role"`
+	// bcrypt hash, never returned by the APIs
+	PasswordHash string `json:"-"`
+}
+
+// APIToken lets automation authenticate as a user. Only the SHA-256 of the
+// token is stored, the token itself is shown once when it is created.
+type APIToken struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	User    string    `json:"user"`
+	Hash    string    `json:"-"`
+	Created time.Time `json:"created"`
+}
@@ -0,0 +1,4 @@
+
+//go:generate protoc --go_out=plugins=grpc:. tviewer.proto
+
+package tviewer
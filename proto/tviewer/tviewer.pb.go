@@ -0,0 +1,1451 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: tviewer.proto
+
+// Package tviewer exposes the topology and the devices managed by tviewer
+
+package tviewer
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+// Same semantics as the websocket subscribe filter
+type TopologyFilter struct {
+	// Node name patterns (e.g. "pe-*")
+	Nodes []string `protobuf:"bytes,1,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	Tags  []string `protobuf:"bytes,2,rep,name=tags,proto3" json:"tags,omitempty"`
+	// ISIS area addresses
+	Areas []string `protobuf:"bytes,3,rep,name=areas,proto3" json:"areas,omitempty"`
+	// Overlay layers, empty means all
+	Layers               []string `protobuf:"bytes,4,rep,name=layers,proto3" json:"layers,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TopologyFilter) Reset()         { *m = TopologyFilter{} }
+func (m *TopologyFilter) String() string { return proto.CompactTextString(m) }
+func (*TopologyFilter) ProtoMessage()    {}
+func (*TopologyFilter) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a53d6df85cc7ff7, []int{0}
+}
+
+func (m *TopologyFilter) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TopologyFilter.Unmarshal(m, b)
+}
+func (m *TopologyFilter) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TopologyFilter.Marshal(b, m, deterministic)
+}
+func (m *TopologyFilter) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TopologyFilter.Merge(m, src)
+}
+func (m *TopologyFilter) XXX_Size() int {
+	return xxx_messageInfo_TopologyFilter.Size(m)
+}
+func (m *TopologyFilter) XXX_DiscardUnknown() {
+	xxx_messageInfo_TopologyFilter.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TopologyFilter proto.InternalMessageInfo
+
+func (m *TopologyFilter) GetNodes() []string {
+	if m != nil {
+		return m.Nodes
+	}
+	return nil
+}
+
+func (m *TopologyFilter) GetTags() []string {
+	if m != nil {
+		return m.Tags
+	}
+	return nil
+}
+
+func (m *TopologyFilter) GetAreas() []string {
+	if m != nil {
+		return m.Areas
+	}
+	return nil
+}
+
+func (m *TopologyFilter) GetLayers() []string {
+	if m != nil {
+		return m.Layers
+	}
+	return nil
+}
+
+type GetTopologyRequest struct {
+	Filter               *TopologyFilter `protobuf:"bytes,1,opt,name=filter,proto3" json:"filter,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *GetTopologyRequest) Reset()         { *m = GetTopologyRequest{} }
+func (m *GetTopologyRequest) String() string { return proto.CompactTextString(m) }
+func (*GetTopologyRequest) ProtoMessage()    {}
+func (*GetTopologyRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a53d6df85cc7ff7, []int{1}
+}
+
+func (m *GetTopologyRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetTopologyRequest.Unmarshal(m, b)
+}
+func (m *GetTopologyRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetTopologyRequest.Marshal(b, m, deterministic)
+}
+func (m *GetTopologyRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetTopologyRequest.Merge(m, src)
+}
+func (m *GetTopologyRequest) XXX_Size() int {
+	return xxx_messageInfo_GetTopologyRequest.Size(m)
+}
+func (m *GetTopologyRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetTopologyRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetTopologyRequest proto.InternalMessageInfo
+
+func (m *GetTopologyRequest) GetFilter() *TopologyFilter {
+	if m != nil {
+		return m.Filter
+	}
+	return nil
+}
+
+type WatchTopologyRequest struct {
+	Filter *TopologyFilter `protobuf:"bytes,1,opt,name=filter,proto3" json:"filter,omitempty"`
+	// Send a full snapshot on every change instead of patches
+	FullSnapshots bool `protobuf:"varint,2,opt,name=full_snapshots,json=fullSnapshots,proto3" json:"full_snapshots,omitempty"`
+	// Id of the last event received, to resume after a reconnect
+	ResumeFrom           string   `protobuf:"bytes,3,opt,name=resume_from,json=resumeFrom,proto3" json:"resume_from,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WatchTopologyRequest) Reset()         { *m = WatchTopologyRequest{} }
+func (m *WatchTopologyRequest) String() string { return proto.CompactTextString(m) }
+func (*WatchTopologyRequest) ProtoMessage()    {}
+func (*WatchTopologyRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a53d6df85cc7ff7, []int{2}
+}
+
+func (m *WatchTopologyRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WatchTopologyRequest.Unmarshal(m, b)
+}
+func (m *WatchTopologyRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WatchTopologyRequest.Marshal(b, m, deterministic)
+}
+func (m *WatchTopologyRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WatchTopologyRequest.Merge(m, src)
+}
+func (m *WatchTopologyRequest) XXX_Size() int {
+	return xxx_messageInfo_WatchTopologyRequest.Size(m)
+}
+func (m *WatchTopologyRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_WatchTopologyRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WatchTopologyRequest proto.InternalMessageInfo
+
+func (m *WatchTopologyRequest) GetFilter() *TopologyFilter {
+	if m != nil {
+		return m.Filter
+	}
+	return nil
+}
+
+func (m *WatchTopologyRequest) GetFullSnapshots() bool {
+	if m != nil {
+		return m.FullSnapshots
+	}
+	return false
+}
+
+func (m *WatchTopologyRequest) GetResumeFrom() string {
+	if m != nil {
+		return m.ResumeFrom
+	}
+	return ""
+}
+
+type Topology struct {
+	Version              uint64   `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	Nodes                []*Node  `protobuf:"bytes,2,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Topology) Reset()         { *m = Topology{} }
+func (m *Topology) String() string { return proto.CompactTextString(m) }
+func (*Topology) ProtoMessage()    {}
+func (*Topology) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a53d6df85cc7ff7, []int{3}
+}
+
+func (m *Topology) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Topology.Unmarshal(m, b)
+}
+func (m *Topology) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Topology.Marshal(b, m, deterministic)
+}
+func (m *Topology) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Topology.Merge(m, src)
+}
+func (m *Topology) XXX_Size() int {
+	return xxx_messageInfo_Topology.Size(m)
+}
+func (m *Topology) XXX_DiscardUnknown() {
+	xxx_messageInfo_Topology.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Topology proto.InternalMessageInfo
+
+func (m *Topology) GetVersion() uint64 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *Topology) GetNodes() []*Node {
+	if m != nil {
+		return m.Nodes
+	}
+	return nil
+}
+
+type Node struct {
+	Name       string       `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Interfaces []*Interface `protobuf:"bytes,2,rep,name=interfaces,proto3" json:"interfaces,omitempty"`
+	Tags       []string     `protobuf:"bytes,3,rep,name=tags,proto3" json:"tags,omitempty"`
+	Areas      []string     `protobuf:"bytes,4,rep,name=areas,proto3" json:"areas,omitempty"`
+	// Operator annotation, empty if there is none
+	Annotation           string   `protobuf:"bytes,5,opt,name=annotation,proto3" json:"annotation,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Node) Reset()         { *m = Node{} }
+func (m *Node) String() string { return proto.CompactTextString(m) }
+func (*Node) ProtoMessage()    {}
+func (*Node) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a53d6df85cc7ff7, []int{4}
+}
+
+func (m *Node) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Node.Unmarshal(m, b)
+}
+func (m *Node) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Node.Marshal(b, m, deterministic)
+}
+func (m *Node) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Node.Merge(m, src)
+}
+func (m *Node) XXX_Size() int {
+	return xxx_messageInfo_Node.Size(m)
+}
+func (m *Node) XXX_DiscardUnknown() {
+	xxx_messageInfo_Node.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Node proto.InternalMessageInfo
+
+func (m *Node) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Node) GetInterfaces() []*Interface {
+	if m != nil {
+		return m.Interfaces
+	}
+	return nil
+}
+
+func (m *Node) GetTags() []string {
+	if m != nil {
+		return m.Tags
+	}
+	return nil
+}
+
+func (m *Node) GetAreas() []string {
+	if m != nil {
+		return m.Areas
+	}
+	return nil
+}
+
+func (m *Node) GetAnnotation() string {
+	if m != nil {
+		return m.Annotation
+	}
+	return ""
+}
+
+type Interface struct {
+	Name           string          `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Ipv4           string          `protobuf:"bytes,2,opt,name=ipv4,proto3" json:"ipv4,omitempty"`
+	IsisNeighbours []*IsisNeighbor `protobuf:"bytes,3,rep,name=isis_neighbours,json=isisNeighbours,proto3" json:"isis_neighbours,omitempty"`
+	// Traffic between the last two samples, unset until known
+	Utilization          *Utilization `protobuf:"bytes,4,opt,name=utilization,proto3" json:"utilization,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *Interface) Reset()         { *m = Interface{} }
+func (m *Interface) String() string { return proto.CompactTextString(m) }
+func (*Interface) ProtoMessage()    {}
+func (*Interface) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a53d6df85cc7ff7, []int{5}
+}
+
+func (m *Interface) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Interface.Unmarshal(m, b)
+}
+func (m *Interface) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Interface.Marshal(b, m, deterministic)
+}
+func (m *Interface) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Interface.Merge(m, src)
+}
+func (m *Interface) XXX_Size() int {
+	return xxx_messageInfo_Interface.Size(m)
+}
+func (m *Interface) XXX_DiscardUnknown() {
+	xxx_messageInfo_Interface.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Interface proto.InternalMessageInfo
+
+func (m *Interface) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Interface) GetIpv4() string {
+	if m != nil {
+		return m.Ipv4
+	}
+	return ""
+}
+
+func (m *Interface) GetIsisNeighbours() []*IsisNeighbor {
+	if m != nil {
+		return m.IsisNeighbours
+	}
+	return nil
+}
+
+func (m *Interface) GetUtilization() *Utilization {
+	if m != nil {
+		return m.Utilization
+	}
+	return nil
+}
+
+// Traffic of an interface in bits and packets per second
+type Utilization struct {
+	ReceiveBps           float64  `protobuf:"fixed64,1,opt,name=receive_bps,json=receiveBps,proto3" json:"receive_bps,omitempty"`
+	TransmitBps          float64  `protobuf:"fixed64,2,opt,name=transmit_bps,json=transmitBps,proto3" json:"transmit_bps,omitempty"`
+	ReceivePps           float64  `protobuf:"fixed64,3,opt,name=receive_pps,json=receivePps,proto3" json:"receive_pps,omitempty"`
+	TransmitPps          float64  `protobuf:"fixed64,4,opt,name=transmit_pps,json=transmitPps,proto3" json:"transmit_pps,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Utilization) Reset()         { *m = Utilization{} }
+func (m *Utilization) String() string { return proto.CompactTextString(m) }
+func (*Utilization) ProtoMessage()    {}
+func (*Utilization) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a53d6df85cc7ff7, []int{6}
+}
+
+func (m *Utilization) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Utilization.Unmarshal(m, b)
+}
+func (m *Utilization) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Utilization.Marshal(b, m, deterministic)
+}
+func (m *Utilization) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Utilization.Merge(m, src)
+}
+func (m *Utilization) XXX_Size() int {
+	return xxx_messageInfo_Utilization.Size(m)
+}
+func (m *Utilization) XXX_DiscardUnknown() {
+	xxx_messageInfo_Utilization.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Utilization proto.InternalMessageInfo
+
+func (m *Utilization) GetReceiveBps() float64 {
+	if m != nil {
+		return m.ReceiveBps
+	}
+	return 0
+}
+
+func (m *Utilization) GetTransmitBps() float64 {
+	if m != nil {
+		return m.TransmitBps
+	}
+	return 0
+}
+
+func (m *Utilization) GetReceivePps() float64 {
+	if m != nil {
+		return m.ReceivePps
+	}
+	return 0
+}
+
+func (m *Utilization) GetTransmitPps() float64 {
+	if m != nil {
+		return m.TransmitPps
+	}
+	return 0
+}
+
+type IsisNeighbor struct {
+	Ipv4                 string   `protobuf:"bytes,1,opt,name=ipv4,proto3" json:"ipv4,omitempty"`
+	Areas                []string `protobuf:"bytes,2,rep,name=areas,proto3" json:"areas,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *IsisNeighbor) Reset()         { *m = IsisNeighbor{} }
+func (m *IsisNeighbor) String() string { return proto.CompactTextString(m) }
+func (*IsisNeighbor) ProtoMessage()    {}
+func (*IsisNeighbor) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a53d6df85cc7ff7, []int{7}
+}
+
+func (m *IsisNeighbor) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_IsisNeighbor.Unmarshal(m, b)
+}
+func (m *IsisNeighbor) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_IsisNeighbor.Marshal(b, m, deterministic)
+}
+func (m *IsisNeighbor) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_IsisNeighbor.Merge(m, src)
+}
+func (m *IsisNeighbor) XXX_Size() int {
+	return xxx_messageInfo_IsisNeighbor.Size(m)
+}
+func (m *IsisNeighbor) XXX_DiscardUnknown() {
+	xxx_messageInfo_IsisNeighbor.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_IsisNeighbor proto.InternalMessageInfo
+
+func (m *IsisNeighbor) GetIpv4() string {
+	if m != nil {
+		return m.Ipv4
+	}
+	return ""
+}
+
+func (m *IsisNeighbor) GetAreas() []string {
+	if m != nil {
+		return m.Areas
+	}
+	return nil
+}
+
+type TopologyPatch struct {
+	Version     uint64 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	BaseVersion uint64 `protobuf:"varint,2,opt,name=base_version,json=baseVersion,proto3" json:"base_version,omitempty"`
+	// RFC 6902 operations on the JSON form of the node list, as sent to
+	// websocket clients
+	JsonPatch            string   `protobuf:"bytes,3,opt,name=json_patch,json=jsonPatch,proto3" json:"json_patch,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TopologyPatch) Reset()         { *m = TopologyPatch{} }
+func (m *TopologyPatch) String() string { return proto.CompactTextString(m) }
+func (*TopologyPatch) ProtoMessage()    {}
+func (*TopologyPatch) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a53d6df85cc7ff7, []int{8}
+}
+
+func (m *TopologyPatch) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TopologyPatch.Unmarshal(m, b)
+}
+func (m *TopologyPatch) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TopologyPatch.Marshal(b, m, deterministic)
+}
+func (m *TopologyPatch) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TopologyPatch.Merge(m, src)
+}
+func (m *TopologyPatch) XXX_Size() int {
+	return xxx_messageInfo_TopologyPatch.Size(m)
+}
+func (m *TopologyPatch) XXX_DiscardUnknown() {
+	xxx_messageInfo_TopologyPatch.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TopologyPatch proto.InternalMessageInfo
+
+func (m *TopologyPatch) GetVersion() uint64 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *TopologyPatch) GetBaseVersion() uint64 {
+	if m != nil {
+		return m.BaseVersion
+	}
+	return 0
+}
+
+func (m *TopologyPatch) GetJsonPatch() string {
+	if m != nil {
+		return m.JsonPatch
+	}
+	return ""
+}
+
+type TopologyEvent struct {
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Types that are valid to be assigned to Event:
+	//	*TopologyEvent_Snapshot
+	//	*TopologyEvent_Patch
+	Event                isTopologyEvent_Event `protobuf_oneof:"event"`
+	XXX_NoUnkeyedLiteral struct{}              `json:"-"`
+	XXX_unrecognized     []byte                `json:"-"`
+	XXX_sizecache        int32                 `json:"-"`
+}
+
+func (m *TopologyEvent) Reset()         { *m = TopologyEvent{} }
+func (m *TopologyEvent) String() string { return proto.CompactTextString(m) }
+func (*TopologyEvent) ProtoMessage()    {}
+func (*TopologyEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a53d6df85cc7ff7, []int{9}
+}
+
+func (m *TopologyEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TopologyEvent.Unmarshal(m, b)
+}
+func (m *TopologyEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TopologyEvent.Marshal(b, m, deterministic)
+}
+func (m *TopologyEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TopologyEvent.Merge(m, src)
+}
+func (m *TopologyEvent) XXX_Size() int {
+	return xxx_messageInfo_TopologyEvent.Size(m)
+}
+func (m *TopologyEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_TopologyEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TopologyEvent proto.InternalMessageInfo
+
+func (m *TopologyEvent) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type isTopologyEvent_Event interface {
+	isTopologyEvent_Event()
+}
+
+type TopologyEvent_Snapshot struct {
+	Snapshot *Topology `protobuf:"bytes,2,opt,name=snapshot,proto3,oneof"`
+}
+
+type TopologyEvent_Patch struct {
+	Patch *TopologyPatch `protobuf:"bytes,3,opt,name=patch,proto3,oneof"`
+}
+
+func (*TopologyEvent_Snapshot) isTopologyEvent_Event() {}
+
+func (*TopologyEvent_Patch) isTopologyEvent_Event() {}
+
+func (m *TopologyEvent) GetEvent() isTopologyEvent_Event {
+	if m != nil {
+		return m.Event
+	}
+	return nil
+}
+
+func (m *TopologyEvent) GetSnapshot() *Topology {
+	if x, ok := m.GetEvent().(*TopologyEvent_Snapshot); ok {
+		return x.Snapshot
+	}
+	return nil
+}
+
+func (m *TopologyEvent) GetPatch() *TopologyPatch {
+	if x, ok := m.GetEvent().(*TopologyEvent_Patch); ok {
+		return x.Patch
+	}
+	return nil
+}
+
+// XXX_OneofWrappers is for the internal use of the proto package.
+func (*TopologyEvent) XXX_OneofWrappers() []interface{} {
+	return []interface{}{
+		(*TopologyEvent_Snapshot)(nil),
+		(*TopologyEvent_Patch)(nil),
+	}
+}
+
+type Device struct {
+	Name     string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Ip       string `protobuf:"bytes,2,opt,name=ip,proto3" json:"ip,omitempty"`
+	Port     string `protobuf:"bytes,3,opt,name=port,proto3" json:"port,omitempty"`
+	Username string `protobuf:"bytes,4,opt,name=username,proto3" json:"username,omitempty"`
+	// Write-only: never returned, empty on update keeps the current one
+	Password    string   `protobuf:"bytes,5,opt,name=password,proto3" json:"password,omitempty"`
+	Certificate string   `protobuf:"bytes,6,opt,name=certificate,proto3" json:"certificate,omitempty"`
+	Tags        []string `protobuf:"bytes,7,rep,name=tags,proto3" json:"tags,omitempty"`
+	// Telemetry sample interval in milliseconds, 0 for the default
+	SampleInterval int32 `protobuf:"varint,8,opt,name=sample_interval,json=sampleInterval,proto3" json:"sample_interval,omitempty"`
+	// Credential profile, whose username, password and certificate win over
+	// those of the device
+	Profile string `protobuf:"bytes,9,opt,name=profile,proto3" json:"profile,omitempty"`
+	// Optional client certificate and key for mutual TLS. The key is
+	// write-only like the password.
+	ClientCertificate string `protobuf:"bytes,10,opt,name=client_certificate,json=clientCertificate,proto3" json:"client_certificate,omitempty"`
+	ClientKey         string `protobuf:"bytes,11,opt,name=client_key,json=clientKey,proto3" json:"client_key,omitempty"`
+	// Read-only: earliest expiry of the certificates, in RFC 3339, and
+	// whether it is within the warning period
+	CertificateExpiry    string   `protobuf:"bytes,12,opt,name=certificate_expiry,json=certificateExpiry,proto3" json:"certificate_expiry,omitempty"`
+	CertificateExpiring  bool     `protobuf:"varint,13,opt,name=certificate_expiring,json=certificateExpiring,proto3" json:"certificate_expiring,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Device) Reset()         { *m = Device{} }
+func (m *Device) String() string { return proto.CompactTextString(m) }
+func (*Device) ProtoMessage()    {}
+func (*Device) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a53d6df85cc7ff7, []int{10}
+}
+
+func (m *Device) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Device.Unmarshal(m, b)
+}
+func (m *Device) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Device.Marshal(b, m, deterministic)
+}
+func (m *Device) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Device.Merge(m, src)
+}
+func (m *Device) XXX_Size() int {
+	return xxx_messageInfo_Device.Size(m)
+}
+func (m *Device) XXX_DiscardUnknown() {
+	xxx_messageInfo_Device.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Device proto.InternalMessageInfo
+
+func (m *Device) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Device) GetIp() string {
+	if m != nil {
+		return m.Ip
+	}
+	return ""
+}
+
+func (m *Device) GetPort() string {
+	if m != nil {
+		return m.Port
+	}
+	return ""
+}
+
+func (m *Device) GetUsername() string {
+	if m != nil {
+		return m.Username
+	}
+	return ""
+}
+
+func (m *Device) GetPassword() string {
+	if m != nil {
+		return m.Password
+	}
+	return ""
+}
+
+func (m *Device) GetCertificate() string {
+	if m != nil {
+		return m.Certificate
+	}
+	return ""
+}
+
+func (m *Device) GetTags() []string {
+	if m != nil {
+		return m.Tags
+	}
+	return nil
+}
+
+func (m *Device) GetSampleInterval() int32 {
+	if m != nil {
+		return m.SampleInterval
+	}
+	return 0
+}
+
+func (m *Device) GetProfile() string {
+	if m != nil {
+		return m.Profile
+	}
+	return ""
+}
+
+func (m *Device) GetClientCertificate() string {
+	if m != nil {
+		return m.ClientCertificate
+	}
+	return ""
+}
+
+func (m *Device) GetClientKey() string {
+	if m != nil {
+		return m.ClientKey
+	}
+	return ""
+}
+
+func (m *Device) GetCertificateExpiry() string {
+	if m != nil {
+		return m.CertificateExpiry
+	}
+	return ""
+}
+
+func (m *Device) GetCertificateExpiring() bool {
+	if m != nil {
+		return m.CertificateExpiring
+	}
+	return false
+}
+
+type ListDevicesRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListDevicesRequest) Reset()         { *m = ListDevicesRequest{} }
+func (m *ListDevicesRequest) String() string { return proto.CompactTextString(m) }
+func (*ListDevicesRequest) ProtoMessage()    {}
+func (*ListDevicesRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a53d6df85cc7ff7, []int{11}
+}
+
+func (m *ListDevicesRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListDevicesRequest.Unmarshal(m, b)
+}
+func (m *ListDevicesRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListDevicesRequest.Marshal(b, m, deterministic)
+}
+func (m *ListDevicesRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListDevicesRequest.Merge(m, src)
+}
+func (m *ListDevicesRequest) XXX_Size() int {
+	return xxx_messageInfo_ListDevicesRequest.Size(m)
+}
+func (m *ListDevicesRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListDevicesRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListDevicesRequest proto.InternalMessageInfo
+
+type ListDevicesResponse struct {
+	Devices              []*Device `protobuf:"bytes,1,rep,name=devices,proto3" json:"devices,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *ListDevicesResponse) Reset()         { *m = ListDevicesResponse{} }
+func (m *ListDevicesResponse) String() string { return proto.CompactTextString(m) }
+func (*ListDevicesResponse) ProtoMessage()    {}
+func (*ListDevicesResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a53d6df85cc7ff7, []int{12}
+}
+
+func (m *ListDevicesResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListDevicesResponse.Unmarshal(m, b)
+}
+func (m *ListDevicesResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListDevicesResponse.Marshal(b, m, deterministic)
+}
+func (m *ListDevicesResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListDevicesResponse.Merge(m, src)
+}
+func (m *ListDevicesResponse) XXX_Size() int {
+	return xxx_messageInfo_ListDevicesResponse.Size(m)
+}
+func (m *ListDevicesResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListDevicesResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListDevicesResponse proto.InternalMessageInfo
+
+func (m *ListDevicesResponse) GetDevices() []*Device {
+	if m != nil {
+		return m.Devices
+	}
+	return nil
+}
+
+type GetDeviceRequest struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetDeviceRequest) Reset()         { *m = GetDeviceRequest{} }
+func (m *GetDeviceRequest) String() string { return proto.CompactTextString(m) }
+func (*GetDeviceRequest) ProtoMessage()    {}
+func (*GetDeviceRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a53d6df85cc7ff7, []int{13}
+}
+
+func (m *GetDeviceRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetDeviceRequest.Unmarshal(m, b)
+}
+func (m *GetDeviceRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetDeviceRequest.Marshal(b, m, deterministic)
+}
+func (m *GetDeviceRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetDeviceRequest.Merge(m, src)
+}
+func (m *GetDeviceRequest) XXX_Size() int {
+	return xxx_messageInfo_GetDeviceRequest.Size(m)
+}
+func (m *GetDeviceRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetDeviceRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetDeviceRequest proto.InternalMessageInfo
+
+func (m *GetDeviceRequest) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+type CreateDeviceRequest struct {
+	Device               *Device  `protobuf:"bytes,1,opt,name=device,proto3" json:"device,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CreateDeviceRequest) Reset()         { *m = CreateDeviceRequest{} }
+func (m *CreateDeviceRequest) String() string { return proto.CompactTextString(m) }
+func (*CreateDeviceRequest) ProtoMessage()    {}
+func (*CreateDeviceRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a53d6df85cc7ff7, []int{14}
+}
+
+func (m *CreateDeviceRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CreateDeviceRequest.Unmarshal(m, b)
+}
+func (m *CreateDeviceRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CreateDeviceRequest.Marshal(b, m, deterministic)
+}
+func (m *CreateDeviceRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CreateDeviceRequest.Merge(m, src)
+}
+func (m *CreateDeviceRequest) XXX_Size() int {
+	return xxx_messageInfo_CreateDeviceRequest.Size(m)
+}
+func (m *CreateDeviceRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_CreateDeviceRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CreateDeviceRequest proto.InternalMessageInfo
+
+func (m *CreateDeviceRequest) GetDevice() *Device {
+	if m != nil {
+		return m.Device
+	}
+	return nil
+}
+
+type UpdateDeviceRequest struct {
+	Device               *Device  `protobuf:"bytes,1,opt,name=device,proto3" json:"device,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *UpdateDeviceRequest) Reset()         { *m = UpdateDeviceRequest{} }
+func (m *UpdateDeviceRequest) String() string { return proto.CompactTextString(m) }
+func (*UpdateDeviceRequest) ProtoMessage()    {}
+func (*UpdateDeviceRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a53d6df85cc7ff7, []int{15}
+}
+
+func (m *UpdateDeviceRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UpdateDeviceRequest.Unmarshal(m, b)
+}
+func (m *UpdateDeviceRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UpdateDeviceRequest.Marshal(b, m, deterministic)
+}
+func (m *UpdateDeviceRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UpdateDeviceRequest.Merge(m, src)
+}
+func (m *UpdateDeviceRequest) XXX_Size() int {
+	return xxx_messageInfo_UpdateDeviceRequest.Size(m)
+}
+func (m *UpdateDeviceRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_UpdateDeviceRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_UpdateDeviceRequest proto.InternalMessageInfo
+
+func (m *UpdateDeviceRequest) GetDevice() *Device {
+	if m != nil {
+		return m.Device
+	}
+	return nil
+}
+
+type DeleteDeviceRequest struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteDeviceRequest) Reset()         { *m = DeleteDeviceRequest{} }
+func (m *DeleteDeviceRequest) String() string { return proto.CompactTextString(m) }
+func (*DeleteDeviceRequest) ProtoMessage()    {}
+func (*DeleteDeviceRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a53d6df85cc7ff7, []int{16}
+}
+
+func (m *DeleteDeviceRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteDeviceRequest.Unmarshal(m, b)
+}
+func (m *DeleteDeviceRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteDeviceRequest.Marshal(b, m, deterministic)
+}
+func (m *DeleteDeviceRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteDeviceRequest.Merge(m, src)
+}
+func (m *DeleteDeviceRequest) XXX_Size() int {
+	return xxx_messageInfo_DeleteDeviceRequest.Size(m)
+}
+func (m *DeleteDeviceRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteDeviceRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteDeviceRequest proto.InternalMessageInfo
+
+func (m *DeleteDeviceRequest) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+type DeleteDeviceResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteDeviceResponse) Reset()         { *m = DeleteDeviceResponse{} }
+func (m *DeleteDeviceResponse) String() string { return proto.CompactTextString(m) }
+func (*DeleteDeviceResponse) ProtoMessage()    {}
+func (*DeleteDeviceResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5a53d6df85cc7ff7, []int{17}
+}
+
+func (m *DeleteDeviceResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteDeviceResponse.Unmarshal(m, b)
+}
+func (m *DeleteDeviceResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteDeviceResponse.Marshal(b, m, deterministic)
+}
+func (m *DeleteDeviceResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteDeviceResponse.Merge(m, src)
+}
+func (m *DeleteDeviceResponse) XXX_Size() int {
+	return xxx_messageInfo_DeleteDeviceResponse.Size(m)
+}
+func (m *DeleteDeviceResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteDeviceResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteDeviceResponse proto.InternalMessageInfo
+
+func init() {
+	proto.RegisterType((*TopologyFilter)(nil), "tviewer.TopologyFilter")
+	proto.RegisterType((*GetTopologyRequest)(nil), "tviewer.GetTopologyRequest")
+	proto.RegisterType((*WatchTopologyRequest)(nil), "tviewer.WatchTopologyRequest")
+	proto.RegisterType((*Topology)(nil), "tviewer.Topology")
+	proto.RegisterType((*Node)(nil), "tviewer.Node")
+	proto.RegisterType((*Interface)(nil), "tviewer.Interface")
+	proto.RegisterType((*Utilization)(nil), "tviewer.Utilization")
+	proto.RegisterType((*IsisNeighbor)(nil), "tviewer.IsisNeighbor")
+	proto.RegisterType((*TopologyPatch)(nil), "tviewer.TopologyPatch")
+	proto.RegisterType((*TopologyEvent)(nil), "tviewer.TopologyEvent")
+	proto.RegisterType((*Device)(nil), "tviewer.Device")
+	proto.RegisterType((*ListDevicesRequest)(nil), "tviewer.ListDevicesRequest")
+	proto.RegisterType((*ListDevicesResponse)(nil), "tviewer.ListDevicesResponse")
+	proto.RegisterType((*GetDeviceRequest)(nil), "tviewer.GetDeviceRequest")
+	proto.RegisterType((*CreateDeviceRequest)(nil), "tviewer.CreateDeviceRequest")
+	proto.RegisterType((*UpdateDeviceRequest)(nil), "tviewer.UpdateDeviceRequest")
+	proto.RegisterType((*DeleteDeviceRequest)(nil), "tviewer.DeleteDeviceRequest")
+	proto.RegisterType((*DeleteDeviceResponse)(nil), "tviewer.DeleteDeviceResponse")
+}
+
+func init() { proto.RegisterFile("tviewer.proto", fileDescriptor_5a53d6df85cc7ff7) }
+
+var fileDescriptor_5a53d6df85cc7ff7 = []byte{
+	// 963 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x56, 0x4d, 0x93, 0x1b, 0x35,
+	0x10, 0xf5, 0xf8, 0xdb, 0x3d, 0xb6, 0x97, 0x68, 0xcd, 0x32, 0x18, 0x16, 0x1c, 0x51, 0x10, 0xe7,
+	0xc0, 0x06, 0x0c, 0x45, 0xc1, 0x25, 0xa1, 0x92, 0x6c, 0x92, 0x0d, 0x90, 0xda, 0x1a, 0x12, 0x38,
+	0xba, 0x66, 0xed, 0xb6, 0x57, 0x64, 0x3c, 0x23, 0x24, 0xd9, 0xc1, 0xfc, 0x03, 0x4e, 0x9c, 0xa8,
+	0xe2, 0xca, 0x99, 0xff, 0xc6, 0x6f, 0xa0, 0x24, 0xcd, 0x8c, 0xe5, 0xb5, 0x17, 0xaa, 0xe0, 0x36,
+	0xfd, 0xfa, 0xe9, 0x75, 0xab, 0x9f, 0x64, 0x19, 0x3a, 0x6a, 0xc5, 0xf0, 0x15, 0x8a, 0x13, 0x2e,
+	0x52, 0x95, 0x92, 0x46, 0x16, 0xd2, 0x4b, 0xe8, 0x3e, 0x4f, 0x79, 0x1a, 0xa7, 0xf3, 0xf5, 0x23,
+	0x16, 0x2b, 0x14, 0xa4, 0x07, 0xb5, 0x24, 0x9d, 0xa2, 0x0c, 0xbc, 0x41, 0x65, 0xd8, 0x0a, 0x6d,
+	0x40, 0x08, 0x54, 0x55, 0x34, 0x97, 0x41, 0xd9, 0x80, 0xe6, 0x5b, 0x33, 0x23, 0x81, 0x91, 0x0c,
+	0x2a, 0x96, 0x69, 0x02, 0x72, 0x04, 0xf5, 0x38, 0x5a, 0xa3, 0x90, 0x41, 0xd5, 0xc0, 0x59, 0x44,
+	0x4f, 0x81, 0x3c, 0x46, 0x95, 0x17, 0x0b, 0xf1, 0xc7, 0x25, 0x4a, 0x45, 0xee, 0x40, 0x7d, 0x66,
+	0xea, 0x06, 0xde, 0xc0, 0x1b, 0xfa, 0xa3, 0x37, 0x4e, 0xf2, 0x46, 0xb7, 0xdb, 0x0a, 0x33, 0x1a,
+	0xfd, 0xd5, 0x83, 0xde, 0xf7, 0x91, 0x9a, 0x5c, 0xfe, 0x5f, 0x25, 0xf2, 0x3e, 0x74, 0x67, 0xcb,
+	0x38, 0x1e, 0xcb, 0x24, 0xe2, 0xf2, 0x32, 0x55, 0x7a, 0x73, 0xde, 0xb0, 0x19, 0x76, 0x34, 0xfa,
+	0x6d, 0x0e, 0x92, 0x77, 0xc1, 0x17, 0x28, 0x97, 0x0b, 0x1c, 0xcf, 0x44, 0xba, 0x08, 0x2a, 0x03,
+	0x6f, 0xd8, 0x0a, 0xc1, 0x42, 0x8f, 0x44, 0xba, 0xa0, 0x67, 0xd0, 0xcc, 0x2b, 0x90, 0x00, 0x1a,
+	0x2b, 0x14, 0x92, 0xa5, 0x89, 0xe9, 0xa2, 0x1a, 0xe6, 0x21, 0x79, 0x2f, 0x1f, 0xab, 0x9e, 0xa0,
+	0x3f, 0xea, 0x14, 0xdd, 0x3d, 0x4b, 0xa7, 0x98, 0x4d, 0x99, 0xfe, 0xee, 0x41, 0x55, 0xc7, 0x7a,
+	0xdc, 0x49, 0xb4, 0x40, 0x23, 0xd2, 0x0a, 0xcd, 0x37, 0x19, 0x01, 0xb0, 0x44, 0xa1, 0x98, 0x45,
+	0x93, 0x42, 0x86, 0x14, 0x32, 0x67, 0x79, 0x2a, 0x74, 0x58, 0x85, 0x6d, 0x95, 0x7d, 0xb6, 0x55,
+	0x5d, 0xdb, 0xde, 0x01, 0x88, 0x92, 0x24, 0x55, 0x91, 0xd2, 0xcd, 0xd7, 0xec, 0x2e, 0x37, 0x08,
+	0xfd, 0xd3, 0x83, 0x56, 0x51, 0x63, 0x6f, 0x7f, 0x04, 0xaa, 0x8c, 0xaf, 0x3e, 0x35, 0x53, 0x6c,
+	0x85, 0xe6, 0x9b, 0xdc, 0x85, 0x03, 0x26, 0x99, 0x1c, 0x27, 0xc8, 0xe6, 0x97, 0x17, 0xe9, 0x52,
+	0xd8, 0x56, 0xfc, 0xd1, 0xeb, 0x9b, 0xc6, 0x25, 0x93, 0xcf, 0x6c, 0x5a, 0x84, 0x5d, 0xb6, 0x89,
+	0x96, 0x42, 0x92, 0xcf, 0xc0, 0x5f, 0x2a, 0x16, 0xb3, 0x9f, 0x6d, 0x5b, 0x55, 0xe3, 0x6c, 0xaf,
+	0x58, 0xfb, 0x62, 0x93, 0x0b, 0x5d, 0x22, 0xfd, 0xcd, 0x03, 0xdf, 0x49, 0x5a, 0x13, 0x27, 0xc8,
+	0x56, 0x38, 0xbe, 0xe0, 0xd2, 0xb4, 0xed, 0x85, 0x90, 0x41, 0xf7, 0xb9, 0x24, 0x37, 0xa1, 0xad,
+	0x44, 0x94, 0xc8, 0x05, 0x53, 0x86, 0x51, 0x36, 0x0c, 0x3f, 0xc7, 0x34, 0xc5, 0xd1, 0xe0, 0x5c,
+	0x06, 0x95, 0x2d, 0x8d, 0xf3, 0x2b, 0x1a, 0x9a, 0x51, 0xdd, 0xd6, 0x38, 0xe7, 0x92, 0x7e, 0x0e,
+	0x6d, 0x77, 0xbf, 0xc5, 0xcc, 0x3c, 0x67, 0x66, 0x85, 0x3f, 0x65, 0xc7, 0x1f, 0xfa, 0x12, 0x3a,
+	0xf9, 0x29, 0x3b, 0xd7, 0xc7, 0xff, 0x1f, 0x8e, 0xda, 0x4d, 0x68, 0x5f, 0x44, 0x12, 0xc7, 0x79,
+	0xba, 0x6c, 0xd2, 0xbe, 0xc6, 0xbe, 0xcb, 0x28, 0xc7, 0x00, 0x3f, 0xc8, 0x34, 0x19, 0x73, 0x2d,
+	0x95, 0x9d, 0xe9, 0x96, 0x46, 0x8c, 0x36, 0xfd, 0xc5, 0xdb, 0x54, 0x3b, 0x5d, 0x61, 0xa2, 0x48,
+	0x17, 0xca, 0x6c, 0x9a, 0xb5, 0x59, 0x66, 0x53, 0x72, 0x07, 0x9a, 0xf9, 0xbd, 0x31, 0xfa, 0xfe,
+	0xe8, 0xc6, 0xce, 0x7d, 0x7b, 0x52, 0x0a, 0x0b, 0x12, 0x39, 0x81, 0xda, 0xa6, 0x98, 0x3f, 0x3a,
+	0xda, 0x61, 0x9b, 0xca, 0x4f, 0x4a, 0xa1, 0xa5, 0xdd, 0x6f, 0x40, 0x0d, 0x75, 0x65, 0xfa, 0x47,
+	0x05, 0xea, 0x0f, 0x71, 0xc5, 0xae, 0x39, 0x75, 0xba, 0x31, 0x9e, 0x9d, 0xb9, 0x32, 0xe3, 0x9a,
+	0xc3, 0x53, 0xa1, 0xb2, 0x3d, 0x99, 0x6f, 0xd2, 0x87, 0xe6, 0x52, 0xa2, 0x30, 0x6b, 0xab, 0x06,
+	0x2f, 0x62, 0x9d, 0xe3, 0x91, 0x94, 0xaf, 0x52, 0x31, 0xcd, 0x4e, 0x7d, 0x11, 0x93, 0x01, 0xf8,
+	0x13, 0x14, 0x8a, 0xcd, 0xd8, 0x24, 0x52, 0x18, 0xd4, 0x4d, 0xda, 0x85, 0x8a, 0xfb, 0xd5, 0x70,
+	0xee, 0xd7, 0x2d, 0x38, 0x90, 0xd1, 0x82, 0xc7, 0x38, 0x36, 0x17, 0x71, 0x15, 0xc5, 0x41, 0x73,
+	0xe0, 0x0d, 0x6b, 0x61, 0xd7, 0xc2, 0x67, 0x19, 0xaa, 0x1d, 0xe4, 0x22, 0x9d, 0xb1, 0x18, 0x83,
+	0x96, 0x91, 0xce, 0x43, 0xf2, 0x21, 0x90, 0x49, 0xcc, 0x30, 0x51, 0x63, 0xb7, 0x3e, 0x18, 0xd2,
+	0x0d, 0x9b, 0x79, 0xe0, 0x74, 0x71, 0x0c, 0x90, 0xd1, 0x5f, 0xe2, 0x3a, 0xf0, 0xad, 0x9b, 0x16,
+	0xf9, 0x0a, 0xd7, 0x46, 0x6d, 0xc3, 0x1e, 0xe3, 0x4f, 0x9c, 0x89, 0x75, 0xd0, 0xce, 0xd4, 0x36,
+	0x99, 0x53, 0x93, 0x20, 0x1f, 0x43, 0x6f, 0x87, 0xce, 0x92, 0x79, 0xd0, 0x31, 0xbf, 0x8e, 0x87,
+	0x57, 0x17, 0xb0, 0x64, 0x4e, 0x7b, 0x40, 0xbe, 0x66, 0x52, 0x59, 0x9b, 0x64, 0xf6, 0x8b, 0x4c,
+	0xbf, 0x84, 0xc3, 0x2d, 0x54, 0xf2, 0x34, 0x91, 0x48, 0x6e, 0x43, 0x63, 0x6a, 0x21, 0xf3, 0xc4,
+	0xf8, 0xa3, 0x83, 0xe2, 0x2c, 0x58, 0x6a, 0x98, 0xe7, 0xe9, 0x07, 0xf0, 0xda, 0x63, 0xcc, 0x04,
+	0xf2, 0xdf, 0xf9, 0x3d, 0x87, 0x80, 0xde, 0x85, 0xc3, 0x07, 0x02, 0x23, 0x85, 0xdb, 0xd4, 0x5b,
+	0x50, 0xb7, 0x4a, 0xd9, 0x93, 0xb0, 0x53, 0x28, 0x4b, 0xeb, 0xf5, 0x2f, 0xf8, 0xf4, 0xbf, 0xaf,
+	0xbf, 0x0d, 0x87, 0x0f, 0x31, 0x46, 0x85, 0xff, 0xde, 0xea, 0x11, 0xf4, 0xb6, 0xa9, 0x76, 0x2a,
+	0xa3, 0xbf, 0x2a, 0xd0, 0x78, 0x6e, 0xd5, 0xc9, 0x3d, 0xf0, 0x9d, 0xa7, 0x92, 0xbc, 0x55, 0x94,
+	0xdd, 0x7d, 0x40, 0xfb, 0xbb, 0xd7, 0x8e, 0x96, 0xc8, 0x53, 0xe8, 0x6c, 0xbd, 0x91, 0xe4, 0xb8,
+	0x60, 0xed, 0x7b, 0x3b, 0xfb, 0xbb, 0xb7, 0xd1, 0xdc, 0x7a, 0x5a, 0xfa, 0xc8, 0x23, 0x4f, 0xc1,
+	0x77, 0x5c, 0x74, 0x9a, 0xd9, 0x75, 0xbc, 0xff, 0xf6, 0xfe, 0xa4, 0xdd, 0x22, 0x2d, 0x91, 0x2f,
+	0xa0, 0x55, 0xf8, 0x49, 0xde, 0x74, 0xb7, 0xb5, 0x35, 0xb8, 0xfe, 0xd5, 0x41, 0xd3, 0x12, 0xb9,
+	0x07, 0x6d, 0xd7, 0x62, 0xb2, 0x29, 0xb5, 0xc7, 0xf9, 0x6b, 0x04, 0x5c, 0x8f, 0x1d, 0x81, 0x3d,
+	0xd6, 0xef, 0x13, 0xf8, 0x06, 0xda, 0xae, 0x73, 0x8e, 0xc0, 0x1e, 0xef, 0xfb, 0xc7, 0xd7, 0x64,
+	0xf3, 0x59, 0x5c, 0xd4, 0xcd, 0x3f, 0xb1, 0x4f, 0xfe, 0x1e, 0x00, 0x0d, 0x52, 0x13, 0x6d, 0x9a,
+	0x09, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// TviewerClient is the client API for Tviewer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type TviewerClient interface {
+	// Current topology, optionally filtered
+	GetTopology(ctx context.Context, in *GetTopologyRequest, opts ...grpc.CallOption) (*Topology, error)
+	// Snapshot of the topology followed by its changes
+	WatchTopology(ctx context.Context, in *WatchTopologyRequest, opts ...grpc.CallOption) (Tviewer_WatchTopologyClient, error)
+	ListDevices(ctx context.Context, in *ListDevicesRequest, opts ...grpc.CallOption) (*ListDevicesResponse, error)
+	GetDevice(ctx context.Context, in *GetDeviceRequest, opts ...grpc.CallOption) (*Device, error)
+	// Onboards the device and starts collecting from it. Unlike the REST API
+	// it waits until the device is stored or the onboarding rolled back.
+	CreateDevice(ctx context.Context, in *CreateDeviceRequest, opts ...grpc.CallOption) (*Device, error)
+	// Replaces the device, restarting its collectors if needed
+	UpdateDevice(ctx context.Context, in *UpdateDeviceRequest, opts ...grpc.CallOption) (*Device, error)
+	DeleteDevice(ctx context.Context, in *DeleteDeviceRequest, opts ...grpc.CallOption) (*DeleteDeviceResponse, error)
+}
+
+type tviewerClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewTviewerClient(cc *grpc.ClientConn) TviewerClient {
+	return &tviewerClient{cc}
+}
+
+func (c *tviewerClient) GetTopology(ctx context.Context, in *GetTopologyRequest, opts ...grpc.CallOption) (*Topology, error) {
+	out := new(Topology)
+	err := c.cc.Invoke(ctx, "/tviewer.Tviewer/GetTopology", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tviewerClient) WatchTopology(ctx context.Context, in *WatchTopologyRequest, opts ...grpc.CallOption) (Tviewer_WatchTopologyClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Tviewer_serviceDesc.Streams[0], "/tviewer.Tviewer/WatchTopology", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &tviewerWatchTopologyClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Tviewer_WatchTopologyClient interface {
+	Recv() (*TopologyEvent, error)
+	grpc.ClientStream
+}
+
+type tviewerWatchTopologyClient struct {
+	grpc.ClientStream
+}
+
+func (x *tviewerWatchTopologyClient) Recv() (*TopologyEvent, error) {
+	m := new(TopologyEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *tviewerClient) ListDevices(ctx context.Context, in *ListDevicesRequest, opts ...grpc.CallOption) (*ListDevicesResponse, error) {
+	out := new(ListDevicesResponse)
+	err := c.cc.Invoke(ctx, "/tviewer.Tviewer/ListDevices", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tviewerClient) GetDevice(ctx context.Context, in *GetDeviceRequest, opts ...grpc.CallOption) (*Device, error) {
+	out := new(Device)
+	err := c.cc.Invoke(ctx, "/tviewer.Tviewer/GetDevice", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tviewerClient) CreateDevice(ctx context.Context, in *CreateDeviceRequest, opts ...grpc.CallOption) (*Device, error) {
+	out := new(Device)
+	err := c.cc.Invoke(ctx, "/tviewer.Tviewer/CreateDevice", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tviewerClient) UpdateDevice(ctx context.Context, in *UpdateDeviceRequest, opts ...grpc.CallOption) (*Device, error) {
+	out := new(Device)
+	err := c.cc.Invoke(ctx, "/tviewer.Tviewer/UpdateDevice", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tviewerClient) DeleteDevice(ctx context.Context, in *DeleteDeviceRequest, opts ...grpc.CallOption) (*DeleteDeviceResponse, error) {
+	out := new(DeleteDeviceResponse)
+	err := c.cc.Invoke(ctx, "/tviewer.Tviewer/DeleteDevice", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TviewerServer is the server API for Tviewer service.
+type TviewerServer interface {
+	// Current topology, optionally filtered
+	GetTopology(context.Context, *GetTopologyRequest) (*Topology, error)
+	// Snapshot of the topology followed by its changes
+	WatchTopology(*WatchTopologyRequest, Tviewer_WatchTopologyServer) error
+	ListDevices(context.Context, *ListDevicesRequest) (*ListDevicesResponse, error)
+	GetDevice(context.Context, *GetDeviceRequest) (*Device, error)
+	// Onboards the device and starts collecting from it. Unlike the REST API
+	// it waits until the device is stored or the onboarding rolled back.
+	CreateDevice(context.Context, *CreateDeviceRequest) (*Device, error)
+	// Replaces the device, restarting its collectors if needed
+	UpdateDevice(context.Context, *UpdateDeviceRequest) (*Device, error)
+	DeleteDevice(context.Context, *DeleteDeviceRequest) (*DeleteDeviceResponse, error)
+}
+
+// UnimplementedTviewerServer can be embedded to have forward compatible implementations.
+type UnimplementedTviewerServer struct {
+}
+
+func (*UnimplementedTviewerServer) GetTopology(ctx context.Context, req *GetTopologyRequest) (*Topology, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTopology not implemented")
+}
+func (*UnimplementedTviewerServer) WatchTopology(req *WatchTopologyRequest, srv Tviewer_WatchTopologyServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchTopology not implemented")
+}
+func (*UnimplementedTviewerServer) ListDevices(ctx context.Context, req *ListDevicesRequest) (*ListDevicesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDevices not implemented")
+}
+func (*UnimplementedTviewerServer) GetDevice(ctx context.Context, req *GetDeviceRequest) (*Device, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDevice not implemented")
+}
+func (*UnimplementedTviewerServer) CreateDevice(ctx context.Context, req *CreateDeviceRequest) (*Device, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateDevice not implemented")
+}
+func (*UnimplementedTviewerServer) UpdateDevice(ctx context.Context, req *UpdateDeviceRequest) (*Device, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateDevice not implemented")
+}
+func (*UnimplementedTviewerServer) DeleteDevice(ctx context.Context, req *DeleteDeviceRequest) (*DeleteDeviceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteDevice not implemented")
+}
+
+func RegisterTviewerServer(s *grpc.Server, srv TviewerServer) {
+	s.RegisterService(&_Tviewer_serviceDesc, srv)
+}
+
+func _Tviewer_GetTopology_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTopologyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TviewerServer).GetTopology(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tviewer.Tviewer/GetTopology",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TviewerServer).GetTopology(ctx, req.(*GetTopologyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tviewer_WatchTopology_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchTopologyRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TviewerServer).WatchTopology(m, &tviewerWatchTopologyServer{stream})
+}
+
+type Tviewer_WatchTopologyServer interface {
+	Send(*TopologyEvent) error
+	grpc.ServerStream
+}
+
+type tviewerWatchTopologyServer struct {
+	grpc.ServerStream
+}
+
+func (x *tviewerWatchTopologyServer) Send(m *TopologyEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Tviewer_ListDevices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDevicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TviewerServer).ListDevices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tviewer.Tviewer/ListDevices",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TviewerServer).ListDevices(ctx, req.(*ListDevicesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tviewer_GetDevice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDeviceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TviewerServer).GetDevice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tviewer.Tviewer/GetDevice",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TviewerServer).GetDevice(ctx, req.(*GetDeviceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tviewer_CreateDevice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateDeviceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TviewerServer).CreateDevice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tviewer.Tviewer/CreateDevice",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TviewerServer).CreateDevice(ctx, req.(*CreateDeviceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tviewer_UpdateDevice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateDeviceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TviewerServer).UpdateDevice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tviewer.Tviewer/UpdateDevice",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TviewerServer).UpdateDevice(ctx, req.(*UpdateDeviceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tviewer_DeleteDevice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteDeviceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TviewerServer).DeleteDevice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tviewer.Tviewer/DeleteDevice",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TviewerServer).DeleteDevice(ctx, req.(*DeleteDeviceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Tviewer_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "tviewer.Tviewer",
+	HandlerType: (*TviewerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetTopology",
+			Handler:    _Tviewer_GetTopology_Handler,
+		},
+		{
+			MethodName: "ListDevices",
+			Handler:    _Tviewer_ListDevices_Handler,
+		},
+		{
+			MethodName: "GetDevice",
+			Handler:    _Tviewer_GetDevice_Handler,
+		},
+		{
+			MethodName: "CreateDevice",
+			Handler:    _Tviewer_CreateDevice_Handler,
+		},
+		{
+			MethodName: "UpdateDevice",
+			Handler:    _Tviewer_UpdateDevice_Handler,
+		},
+		{
+			MethodName: "DeleteDevice",
+			Handler:    _Tviewer_DeleteDevice_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchTopology",
+			Handler:       _Tviewer_WatchTopology_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "tviewer.proto",
+}
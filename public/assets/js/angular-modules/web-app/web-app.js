@@ -116,19 +116,13 @@ appModule.factory('AuthNotifyingService', function($rootScope) {
     };
 });
 
-// This factory adds the token to each API request
+// The UI authenticates with the session cookie, this factory sends the
+// browser to the login page when the session is gone
 appModule.factory("authInterceptor", function($rootScope, $q, $window){
     return {
-        request: function(config){
-            config.headers = config.headers  || {};
-            if ($window.sessionStorage.token){
-                config.headers.Authorization = 'Bearer ' + $window.sessionStorage.token;
-            }
-            return config;
-        },
         responseError: function(rejection){
             if (rejection.status === 401){
-                //Manage common 401 actions
+                $window.location.href = '/login';
             }
             return $q.reject(rejection);
         }
@@ -138,47 +132,57 @@ appModule.factory("authInterceptor", function($rootScope, $q, $window){
 /*  Services    */
 
 /* Authentication */
-appModule.service("AuthService", function($window, $http, $location, AuthNotifyingService){
+appModule.service("AuthService", function($window, $http, $rootScope, AuthNotifyingService){
     function url_base64_decode(str){
         return window.atob(str)
     }
 
     this.url_base64_decode = url_base64_decode
 
-    // if token is not stored, try to get it if not in login page
-    if ($location.$$path != '/login'){
-        if (!$window.sessionStorage.token){
-            $http
-            .get('api/token')
-            .then(function (response, status, headers, config){
-                $window.sessionStorage.token = response.data.token;
-                AuthNotifyingService.notify();
-            })
-            .catch(function(response, status, headers, config){
-                // Any issue go to login
-                $window.location.href = '/login'
-            })
+    // Get the logged in user, the interceptor handles an expired session
+    $http
+    .get('api/session')
+    .then(function (response, status, headers, config){
+        $rootScope.user = response.data;
+        AuthNotifyingService.notify();
+    })
+})
+
 
+/*  Helpers    */
+
+// Get the message out of an API error body ({"error": {"code": ..., "message": ...}})
+function apiErrorMessage(response){
+    if (response.data && response.data.error){
+        var message = response.data.error.message;
+        // Partial failures list the steps that failed
+        if (angular.isArray(response.data.error.details)){
+            response.data.error.details.forEach(function(step){
+                if (step.error){
+                    message += '. ' + step.step + ': ' + step.error;
+                }
+            });
         }
+        return message;
     }
-})
-
+    return response.statusText || 'Request failed';
+}
 
 /*  Controllers    */
 
-appModule.controller('AuthController', function($scope, $http, $window, AuthService, AuthNotifyingService){
+appModule.controller('AuthController', function($scope, $rootScope, $http, $window, AuthService, AuthNotifyingService){
 
 
 
     $scope.logout = function() {
         $scope.isAuthenticated = false;
-        $window.sessionStorage.token = '';
         $window.location.href = '/web/logout'
     }
 
 
-    AuthNotifyingService.subscribe($scope, function updateToken() {
-        $scope.token = $window.sessionStorage.token;
+    AuthNotifyingService.subscribe($scope, function updateUser() {
+        $scope.isAuthenticated = true;
+        $scope.user = $rootScope.user;
     });
 });
 
@@ -196,6 +200,8 @@ appModule.controller('AppController', function($scope, $location, $http){
 
     $scope.devices = []
     $scope.device = {}
+    $scope.jobs = []
+    var jobsSocket = null;
     $scope.error = "";
     $scope.success = ""
     $scope.loading = false;
@@ -208,8 +214,15 @@ appModule.controller('AppController', function($scope, $location, $http){
         $scope.success = "";
     };
 
+    // A credential profile can stand in for the username, password and certificate.
+    // Passwords are never returned, so updates without one keep the current password
+    function hasCredentials(device){
+        return device.profile || (device.username && (device.password || $scope.isUpdate) && device.certificate);
+    }
+
     $scope.editDevice = function(pDevice){
-        $scope.device = pDevice;
+        // Edit a copy so the table does not change until the update is saved
+        $scope.device = angular.copy(pDevice);
         $scope.isUpdate = true
     };
 
@@ -222,24 +235,74 @@ appModule.controller('AppController', function($scope, $location, $http){
         $scope.clearError();
         $scope.clearSuccess();
 
-        if(!($scope.device.name && $scope.device.ip && $scope.device.username && $scope.device.password && $scope.device.port && $scope.device.certificate)){
+        if(!($scope.device.name && $scope.device.ip && $scope.device.port && hasCredentials($scope.device))){
             $scope.error = "Please complete all fields";
             return;
         }
         $scope.loading = true;
         $http
-            .post('/api/device', $scope.device)
+            .post('/api/devices', $scope.device)
             .then(function (response, status, headers, config){
-               $scope.success = "Device Added!"
+               // Onboarding goes on in the background, progress comes through the jobs websocket
+               $scope.success = "Onboarding " + response.data.device + " started"
+               updateJob(response.data);
+               $scope.newDevice();
+            })
+            .catch(function(response, status, headers, config){
+                $scope.error = apiErrorMessage(response)
+            })
+            .finally(function(){
+                $scope.loading = false;
+            })
+
+    };
+
+    $scope.updateDevice = function(){
+        $scope.clearError();
+        $scope.clearSuccess();
+
+        if(!($scope.device.ip && $scope.device.port && hasCredentials($scope.device))){
+            $scope.error = "Please complete all fields";
+            return;
+        }
+        $scope.loading = true;
+        $http
+            .put('/api/devices/' + encodeURIComponent($scope.device.name), $scope.device)
+            .then(function (response, status, headers, config){
+               $scope.success = "Device Updated!"
+               $scope.device = response.data;
                $scope.getDevices();
             })
             .catch(function(response, status, headers, config){
-                $scope.error = response.data
+                $scope.error = apiErrorMessage(response)
+            })
+            .finally(function(){
+                $scope.loading = false;
+            })
+
+    };
+
+    // Shows what adding the device would push without touching the router
+    $scope.previewDevice = function(){
+        $scope.clearError();
+        $scope.clearSuccess();
+        $scope.preview = null;
+        $scope.loading = true;
+        $http
+            .post('/api/devices?dryRun=true', $scope.device)
+            .then(function (response, status, headers, config){
+               $scope.preview = response.data;
+            })
+            .catch(function(response, status, headers, config){
+                $scope.error = apiErrorMessage(response)
             })
             .finally(function(){
                 $scope.loading = false;
             })
+    };
 
+    $scope.toJson = function(value){
+        return angular.toJson(value, true);
     };
 
     $scope.deleteDevice = function(){
@@ -247,14 +310,19 @@ appModule.controller('AppController', function($scope, $location, $http){
         $scope.clearSuccess();
         $scope.loading = true;
         $http
-            .delete('/api/device?name=' + $scope.device.name)
+            .delete('/api/devices/' + encodeURIComponent($scope.device.name))
             .then(function (response, status, headers, config){
                $scope.success = "Device Deleted!"
                $scope.getDevices();
                $scope.newDevice();
             })
             .catch(function(response, status, headers, config){
-                $scope.error = response.data
+                $scope.error = apiErrorMessage(response)
+                // The device is removed even if some cleanup failed
+                if (response.data && response.data.error && response.data.error.code === 'partial_failure'){
+                    $scope.getDevices();
+                    $scope.newDevice();
+                }
             })
             .finally(function(){
                 $scope.loading = false;
@@ -262,10 +330,27 @@ appModule.controller('AppController', function($scope, $location, $http){
 
     };
 
+    $scope.restartDevice = function(){
+        $scope.clearError();
+        $scope.clearSuccess();
+        $scope.loading = true;
+        $http
+            .post('/api/devices/' + encodeURIComponent($scope.device.name) + '/restart')
+            .then(function (response, status, headers, config){
+               $scope.success = "Collectors restarted!"
+            })
+            .catch(function(response, status, headers, config){
+                $scope.error = apiErrorMessage(response)
+            })
+            .finally(function(){
+                $scope.loading = false;
+            })
+    };
+
      $scope.getDevices = function(){
         $scope.loading = true;
         $http
-            .get('/api/device')
+            .get('/api/devices')
             .then(function (response, status, headers, config){
                 if(angular.isArray(response.data)){
                     $scope.devices = response.data;
@@ -276,13 +361,59 @@ appModule.controller('AppController', function($scope, $location, $http){
 
             })
             .catch(function(response, status, headers, config){
-                $scope.error = response.data
+                $scope.error = apiErrorMessage(response)
             })
             .finally(function(){
                 $scope.loading = false;
             })
     };
 
+    // Replace the job with the same id or add it
+    function updateJob(job){
+        for (var i = 0; i < $scope.jobs.length; i++) {
+            if ($scope.jobs[i].id === job.id){
+                var wasRunning = $scope.jobs[i].status === 'running';
+                $scope.jobs[i] = job;
+                if (wasRunning && job.status === 'succeeded'){
+                    $scope.getDevices();
+                }
+                return;
+            }
+        }
+        $scope.jobs.push(job);
+    }
+
+    $scope.stepLabel = function(name){
+        return name.replace(/_/g, ' ');
+    };
+
+    $scope.watchJobs = function(){
+        if (jobsSocket){
+            return;
+        }
+        jobsSocket = new WebSocket((window.location.protocol === 'https:' ? 'wss://' : 'ws://') + window.location.host + '/ws/jobs');
+        jobsSocket.onmessage = function(event){
+            var message = JSON.parse(event.data);
+            $scope.$apply(function(){
+                if (message.type === 'jobs'){
+                    $scope.jobs = message.data;
+                }
+                if (message.type === 'job'){
+                    updateJob(message.data);
+                }
+            });
+        };
+        jobsSocket.onclose = function(){
+            jobsSocket = null;
+        };
+    };
+
+    $scope.$on('$destroy', function(){
+        if (jobsSocket){
+            jobsSocket.close();
+        }
+    });
+
     // Location logic. This tells the controller what to do according the URL that the user currently is
     $scope.$on('$viewContentLoaded', function(event) {
         if ($location.$$path === '/topology'){
@@ -290,6 +421,7 @@ appModule.controller('AppController', function($scope, $location, $http){
         }
         if ($location.$$path === '/devices'){
             $scope.getDevices();
+            $scope.watchJobs();
         }
     });
 });
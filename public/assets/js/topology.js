@@ -59,17 +59,84 @@ var nxData = {
 };
 
 topology = [];
+topologyVersion = -1;
 
 // Web socket to subscribe from the server
-var ws = new WebSocket('ws://' + window.location.host + '/ws/topology');
+var ws = new WebSocket((window.location.protocol === 'https:' ? 'wss://' : 'ws://') + window.location.host + '/ws/topology');
 
 // Start listening
 ws.addEventListener('message', function (event) {
     // Parse data
-    topology = JSON.parse(event.data);
+    var message = JSON.parse(event.data);
+    if (message.type == 'snapshot'){
+        topology = message.data || [];
+        topologyVersion = message.version;
+    }
+    else if (message.type == 'error'){
+        console.log('Topology subscription error: ' + message.message);
+        return;
+    }
+    else if (message.type == 'patch'){
+        if (message.baseVersion != topologyVersion){
+            // Missed an update, ask for the whole topology again
+            ws.send(JSON.stringify({type: 'resync'}));
+            return;
+        }
+        topology = applyPatch(topology, message.ops);
+        topologyVersion = message.version;
+    }
     updateGraphic(topology);
 });
 
+// Only receive the part of the topology that matches the filter, e.g.
+// {nodes: ['pe-*'], tags: ['north'], areas: ['49.0001'], layers: ['isis']}.
+// An empty filter subscribes to the whole topology again
+function subscribeTopology(filter){
+    ws.send(JSON.stringify({type: 'subscribe', filter: filter}));
+}
+
+// Apply RFC 6902 add, remove and replace operations to a document
+function applyPatch(document, ops){
+    for (var i = 0; i < ops.length; i++){
+        var op = ops[i];
+        if (op.path == ''){
+            document = op.value;
+            continue;
+        }
+        var tokens = op.path.substring(1).split('/').map(function(token){
+            return token.replace(/~1/g, '/').replace(/~0/g, '~');
+        });
+        var parent = document;
+        for (var j = 0; j < tokens.length - 1; j++){
+            parent = parent[tokens[j]];
+        }
+        var key = tokens[tokens.length - 1];
+        if (Array.isArray(parent)){
+            if (op.op == 'add'){
+                if (key == '-'){
+                    parent.push(op.value);
+                }
+                else{
+                    parent.splice(parseInt(key), 0, op.value);
+                }
+            }
+            else if (op.op == 'remove'){
+                parent.splice(parseInt(key), 1);
+            }
+            else{
+                parent[parseInt(key)] = op.value;
+            }
+        }
+        else if (op.op == 'remove'){
+            delete parent[key];
+        }
+        else{
+            parent[key] = op.value;
+        }
+    }
+    return document;
+}
+
 
 function updateGraphic(pTopology){
     nxData = {